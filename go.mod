@@ -7,7 +7,10 @@ require (
 	eqrx.net/rungroup v0.0.9
 	eqrx.net/service v0.0.4
 	github.com/go-logr/logr v1.2.3
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/miekg/dns v1.1.50
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	golang.org/x/net v0.0.0-20220425223048-2871e0cb64e4
 	golang.org/x/sys v0.0.0-20220503163025-988cb79eb6c6
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -15,7 +18,6 @@ require (
 require (
 	eqrx.net/journalr v0.0.1 // indirect
 	golang.org/x/mod v0.6.0-dev.0.20220106191415-9b9b3d81d5e3 // indirect
-	golang.org/x/net v0.0.0-20220425223048-2871e0cb64e4 // indirect
 	golang.org/x/tools v0.1.10 // indirect
 	golang.org/x/xerrors v0.0.0-20220411194840-2f41105eb62f // indirect
 )
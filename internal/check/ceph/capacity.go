@@ -0,0 +1,238 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// Capacity contains thresholds on the usage of the cluster. Ratios are between 0 and 1, MinPoolAvail is in bytes.
+// Pools limits the pool thresholds to the given pools, all are checked if empty. Unset thresholds are not checked.
+type Capacity struct {
+	MaxRawUsed   *float64 `yaml:"maxRawUsed"`
+	MaxPoolUsed  *float64 `yaml:"maxPoolUsed"`
+	MinPoolAvail *float64 `yaml:"minPoolAvail"`
+	Pools        []string `yaml:"pools"`
+}
+
+// Scrub contains the maximum age of the last scrub and deep scrub of every PG. Zero ages are not checked.
+type Scrub struct {
+	MaxAge     time.Duration `yaml:"maxAge"`
+	MaxDeepAge time.Duration `yaml:"maxDeepAge"`
+}
+
+// df is the part of `ceph df -f json` the check evaluates.
+type df struct {
+	Stats struct {
+		TotalBytes        float64 `json:"total_bytes"`
+		TotalUsedRawBytes float64 `json:"total_used_raw_bytes"`
+		TotalUsedRawRatio float64 `json:"total_used_raw_ratio"`
+	} `json:"stats"`
+	Pools []dfPool `json:"pools"`
+}
+
+type dfPool struct {
+	Name  string `json:"name"`
+	Stats struct {
+		PercentUsed float64 `json:"percent_used"`
+		MaxAvail    float64 `json:"max_avail"`
+	} `json:"stats"`
+}
+
+// pgStat is the part of a PG in `ceph pg dump pgs -f json` the check evaluates.
+type pgStat struct {
+	PGID               string `json:"pgid"`
+	LastScrubStamp     string `json:"last_scrub_stamp"`
+	LastDeepScrubStamp string `json:"last_deep_scrub_stamp"`
+}
+
+// selected returns if the pool thresholds apply to the named pool.
+func (c Capacity) selected(name string) bool {
+	if len(c.Pools) == 0 {
+		return true
+	}
+
+	for _, pool := range c.Pools {
+		if pool == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verify records the usage of the cluster and its pools and compares them against the thresholds.
+func (c Capacity) verify(usage df, rep *report.Report) []string {
+	problems := []string{}
+
+	rep.Metric("raw_used", usage.Stats.TotalUsedRawRatio, "")
+
+	if c.MaxRawUsed != nil && usage.Stats.TotalUsedRawRatio > *c.MaxRawUsed {
+		problems = append(problems, fmt.Sprintf("raw usage %.3f above %.3f", usage.Stats.TotalUsedRawRatio, *c.MaxRawUsed))
+	}
+
+	for _, pool := range usage.Pools {
+		if !c.selected(pool.Name) {
+			continue
+		}
+
+		sub := rep.Sub("pool " + pool.Name)
+		sub.Metric("used", pool.Stats.PercentUsed, "")
+		sub.Metric("max_avail", pool.Stats.MaxAvail, "B")
+
+		if c.MaxPoolUsed != nil && pool.Stats.PercentUsed > *c.MaxPoolUsed {
+			problems = append(problems,
+				fmt.Sprintf("pool %s usage %.3f above %.3f", pool.Name, pool.Stats.PercentUsed, *c.MaxPoolUsed))
+		}
+
+		if c.MinPoolAvail != nil && pool.Stats.MaxAvail < *c.MinPoolAvail {
+			problems = append(problems,
+				fmt.Sprintf("pool %s has %.0f bytes available, below %.0f", pool.Name, pool.Stats.MaxAvail, *c.MinPoolAvail))
+		}
+	}
+
+	return problems
+}
+
+// checkCapacity evaluates the cluster usage, taken from the samples of the prometheus module if present.
+func (c Check) checkCapacity(ctx context.Context, samples []sample, rep *report.Report) error {
+	var usage df
+
+	if samples != nil {
+		usage = prometheusDF(samples)
+	} else {
+		out, err := c.command(ctx, "df", nil)
+		if err != nil {
+			return fmt.Errorf("query ceph for usage: %w", err)
+		}
+
+		if err := json.Unmarshal(out, &usage); err != nil {
+			return fmt.Errorf("decode usage: %w", err)
+		}
+	}
+
+	if problems := c.Capacity.verify(usage, rep); len(problems) != 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// decodePGStats decodes the output of `ceph pg dump pgs -f json`. Newer releases wrap the PGs into an object.
+func decodePGStats(raw []byte) ([]pgStat, error) {
+	var wrapped struct {
+		PGStats []pgStat `json:"pg_stats"`
+	}
+
+	if err := json.Unmarshal(raw, &wrapped); err == nil {
+		return wrapped.PGStats, nil
+	}
+
+	var stats []pgStat
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		return nil, fmt.Errorf("decode pg stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// parseStamp parses a scrub time stamp. Older releases omit the time zone and use a space as separator.
+func parseStamp(stamp string) (time.Time, error) {
+	parsed, err := time.Parse("2006-01-02T15:04:05.999999-0700", stamp)
+	if err == nil {
+		return parsed, nil
+	}
+
+	parsed, err = time.Parse("2006-01-02 15:04:05.999999", stamp)
+	if err != nil {
+		return parsed, fmt.Errorf("scrub stamp: %w", err)
+	}
+
+	return parsed, nil
+}
+
+// oldest returns the PG with the oldest stamp as returned by stamp together with its age and the number of PGs whose
+// stamp is older than maxAge.
+func oldest(stats []pgStat, stamp func(pgStat) string, maxAge time.Duration) (string, time.Duration, int, error) {
+	oldestPG, oldestAge, exceeding := "", time.Duration(0), 0
+
+	for _, stat := range stats {
+		parsed, err := parseStamp(stamp(stat))
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("pg %s: %w", stat.PGID, err)
+		}
+
+		age := time.Since(parsed)
+
+		if age > oldestAge {
+			oldestPG, oldestAge = stat.PGID, age
+		}
+
+		if maxAge != 0 && age > maxAge {
+			exceeding++
+		}
+	}
+
+	return oldestPG, oldestAge, exceeding, nil
+}
+
+// checkScrub records the ages of the oldest scrub and deep scrub and fails if PGs exceed the maximum ages.
+func (c Check) checkScrub(ctx context.Context, rep *report.Report) error {
+	out, err := c.command(ctx, "pg dump", map[string][]string{"dumpcontents": {"pgs"}})
+	if err != nil {
+		return fmt.Errorf("query ceph for pgs: %w", err)
+	}
+
+	stats, err := decodePGStats(out)
+	if err != nil {
+		return err
+	}
+
+	kinds := []struct {
+		name   string
+		maxAge time.Duration
+		stamp  func(pgStat) string
+	}{
+		{"scrub", c.Scrub.MaxAge, func(stat pgStat) string { return stat.LastScrubStamp }},
+		{"deep_scrub", c.Scrub.MaxDeepAge, func(stat pgStat) string { return stat.LastDeepScrubStamp }},
+	}
+
+	problems := []string{}
+
+	for _, kind := range kinds {
+		pg, age, exceeding, err := oldest(stats, kind.stamp, kind.maxAge)
+		if err != nil {
+			return err
+		}
+
+		rep.Metric("oldest_"+kind.name+"_age", age.Hours(), "h")
+
+		if exceeding != 0 {
+			problems = append(problems, fmt.Sprintf("%d pgs without %s for %s, oldest %s since %s",
+				exceeding, kind.name, kind.maxAge, pg, age.Round(time.Minute)))
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
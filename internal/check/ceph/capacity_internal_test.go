@@ -0,0 +1,93 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodePGStats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"wrapped", `{"pg_ready": true, "pg_stats": [{"pgid": "1.0", "last_scrub_stamp": "x"}]}`},
+		{"plain", `[{"pgid": "1.0", "last_scrub_stamp": "x"}]`},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			stats, err := decodePGStats([]byte(test.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(stats) != 1 || stats[0].PGID != "1.0" || stats[0].LastScrubStamp != "x" {
+				t.Errorf("decodePGStats() = %+v", stats)
+			}
+		})
+	}
+
+	if _, err := decodePGStats([]byte(`"pgs"`)); err == nil {
+		t.Error("decodePGStats() accepted a string")
+	}
+}
+
+func TestParseStamp(t *testing.T) {
+	t.Parallel()
+
+	want := time.Date(2022, 5, 1, 10, 20, 30, 123456000, time.UTC)
+
+	for _, stamp := range []string{"2022-05-01T12:20:30.123456+0200", "2022-05-01 10:20:30.123456"} {
+		parsed, err := parseStamp(stamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !parsed.Equal(want) {
+			t.Errorf("parseStamp(%q) = %s, want %s", stamp, parsed, want)
+		}
+	}
+
+	if _, err := parseStamp("yesterday"); err == nil {
+		t.Error("parseStamp() accepted an invalid stamp")
+	}
+}
+
+func TestOldest(t *testing.T) {
+	t.Parallel()
+
+	format := "2006-01-02T15:04:05.999999-0700"
+	stats := []pgStat{
+		{PGID: "1.0", LastScrubStamp: time.Now().Add(-time.Hour).Format(format)},
+		{PGID: "1.1", LastScrubStamp: time.Now().Add(-72 * time.Hour).Format(format)},
+		{PGID: "1.2", LastScrubStamp: time.Now().Add(-48 * time.Hour).Format(format)},
+	}
+
+	pg, age, exceeding, err := oldest(stats, func(stat pgStat) string { return stat.LastScrubStamp }, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pg != "1.1" || age < 72*time.Hour || exceeding != 2 {
+		t.Errorf("oldest() = %s, %s, %d", pg, age, exceeding)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"path"
 	"strings"
 
+	"eqrx.net/healthcheck/internal/report"
 	"eqrx.net/service"
 	"github.com/go-logr/logr"
 )
@@ -28,34 +29,106 @@ import (
 // StatusOK is the value that ceph reports as health status when everything is good.
 const StatusOK = "HEALTH_OK"
 
-// Check for the status of a ceph cluster.
+// Check for the status of a ceph cluster. Health checks whose code is listed in Mute are ignored, thresholds on the
+// OSD and PG counts can be set in addition. Capacity and scrub thresholds are only checked if configured.
+// If Manager is set, the cluster is queried from the ceph manager over HTTP instead of the ceph CLI.
 type Check struct {
-	ClientName string `yaml:"clientName"`
-	CredsName  string `yaml:"credsName"`
+	ClientName string     `yaml:"clientName"`
+	CredsName  string     `yaml:"credsName"`
+	Manager    *Manager   `yaml:"manager"`
+	Mute       []string   `yaml:"mute"`
+	Thresholds Thresholds `yaml:",inline"`
+	Capacity   *Capacity  `yaml:"capacity"`
+	Scrub      *Scrub     `yaml:"scrub"`
 }
 
-// Check uses exec to execute the command `ceph status -f json` to get the current status of the cluster that is used
-// by the host healthcheck is running on. If the exec succeeds the output is unmarshalled into Report.  Lastly if the
-// field Report->Health->Status is equal to the constant StatusOK nil is returned.
-func (c Check) Check(ctx context.Context, _ logr.Logger) error {
-	credDir, err := service.CredsDir()
-	if err != nil {
-		return fmt.Errorf("ceph key ring: %w", err)
+// Setup prepares the manager if configured.
+func (c *Check) Setup() error {
+	if c.Manager == nil {
+		return nil
+	}
+
+	if c.Scrub != nil && c.Manager.Module == ModulePrometheus {
+		return fmt.Errorf("scrub ages are not available from the prometheus module")
+	}
+
+	return c.Manager.Setup()
+}
+
+// Check gets the current status of the cluster, either from the manager or by executing the command
+// `ceph status -f json` which uses the cluster the host healthcheck is running on. The health checks reported by
+// ceph that are not muted fail the check, as do exceeded thresholds.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	var samples []sample
+
+	if c.Manager != nil && c.Manager.Module == ModulePrometheus {
+		var err error
+		if samples, err = c.Manager.metrics(ctx); err != nil {
+			return fmt.Errorf("query ceph: %w", err)
+		}
 	}
 
-	args := []string{"status", "-n", c.ClientName, "-k", path.Join(credDir, c.CredsName)}
-	cmd := exec.CommandContext(ctx, "ceph", args...)
+	if err := c.checkStatus(ctx, samples, rep); err != nil {
+		return err
+	}
+
+	if c.Capacity != nil {
+		if err := c.checkCapacity(ctx, samples, rep); err != nil {
+			return fmt.Errorf("capacity: %w", err)
+		}
+	}
+
+	if c.Scrub != nil {
+		if err := c.checkScrub(ctx, rep); err != nil {
+			return fmt.Errorf("scrub: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkStatus evaluates the cluster status, taken from the samples of the prometheus module if present.
+func (c Check) checkStatus(ctx context.Context, samples []sample, rep *report.Report) error {
+	if samples != nil {
+		return c.evaluate(prometheusStatus(samples), rep)
+	}
 
-	out, err := cmd.Output()
+	out, err := c.command(ctx, "status", nil)
 	if err != nil {
 		return fmt.Errorf("query ceph for status: %w", err)
 	}
 
-	status := string(out)
+	status, err := decodeStatus(out)
+	if err != nil {
+		return err
+	}
 
-	if !strings.Contains(status, StatusOK) {
-		return fmt.Errorf("ceph reports unhealthy: %v", status)
+	return c.evaluate(status, rep)
+}
+
+// command runs a ceph command with JSON output, either through the restful module of the manager or the ceph CLI
+// with the key ring from the systemd credentials. On the command line the argument values follow the prefix.
+func (c Check) command(ctx context.Context, prefix string, args map[string][]string) ([]byte, error) {
+	if c.Manager != nil {
+		return c.Manager.command(ctx, prefix, args)
 	}
 
-	return nil
+	credDir, err := service.CredsDir()
+	if err != nil {
+		return nil, fmt.Errorf("ceph key ring: %w", err)
+	}
+
+	cmdArgs := strings.Fields(prefix)
+	for _, values := range args {
+		cmdArgs = append(cmdArgs, values...)
+	}
+
+	cmdArgs = append(cmdArgs, "-f", "json", "-n", c.ClientName, "-k", path.Join(credDir, c.CredsName))
+
+	out, err := exec.CommandContext(ctx, "ceph", cmdArgs...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec ceph %s: %w", prefix, err)
+	}
+
+	return out, nil
 }
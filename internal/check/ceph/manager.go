@@ -0,0 +1,184 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"eqrx.net/service"
+)
+
+const (
+	// ModuleRestful selects the restful module of the ceph manager.
+	ModuleRestful = "restful"
+	// ModulePrometheus selects the prometheus module of the ceph manager.
+	ModulePrometheus = "prometheus"
+)
+
+// Credentials are used to authenticate against the ceph manager and verify its certificate. User and key are only
+// needed by the restful module, CA is a PEM encoded certificate and may be left empty to use the system roots.
+type Credentials struct {
+	User string `yaml:"user"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+}
+
+// Manager queries the cluster status from the ceph manager over HTTP instead of running the ceph CLI.
+// URL is the base URL of the selected module.
+type Manager struct {
+	URL       string      `yaml:"url"`
+	Module    string      `yaml:"module"`
+	CredsName string      `yaml:"credsName"`
+	creds     Credentials `yaml:"-"`
+}
+
+type restfulResponse struct {
+	Finished []struct {
+		Outb string `json:"outb"`
+		Outs string `json:"outs"`
+	} `json:"finished"`
+	Failed []struct {
+		Outs string `json:"outs"`
+	} `json:"failed"`
+	HasFailed bool `json:"has_failed"`
+}
+
+// Setup validates the module and loads the credentials if given.
+func (m *Manager) Setup() error {
+	switch m.Module {
+	case ModuleRestful, ModulePrometheus:
+	case "":
+		m.Module = ModuleRestful
+	default:
+		return fmt.Errorf("manager: unknown module %q", m.Module)
+	}
+
+	m.URL = strings.TrimSuffix(m.URL, "/")
+
+	if m.CredsName != "" {
+		if err := service.UnmarshalYAMLCreds(m.CredsName, &m.creds); err != nil {
+			return fmt.Errorf("manager: credentials: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m Manager) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if m.creds.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(m.creds.CA)) {
+			return nil, fmt.Errorf("no certificate found in CA")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, nil
+}
+
+// do executes the request and returns the response body.
+func (m Manager) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	client, err := m.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, m.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create http request: %w", err)
+	}
+
+	if m.creds.User != "" {
+		request.SetBasicAuth(m.creds.User, m.creds.Key)
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("execute http request: %w", err)
+	}
+
+	content, readErr := io.ReadAll(response.Body)
+
+	closeErr := response.Body.Close()
+
+	switch {
+	case response.StatusCode < 200 || response.StatusCode >= 300:
+		return nil, fmt.Errorf("unexpected http response status: %v", response.StatusCode)
+	case readErr != nil:
+		return nil, fmt.Errorf("read body: %w", readErr)
+	case closeErr != nil:
+		return nil, fmt.Errorf("close body: %w", closeErr)
+	default:
+		return content, nil
+	}
+}
+
+// command runs a ceph command with the given arguments through the restful module and returns its JSON output.
+func (m Manager) command(ctx context.Context, prefix string, args map[string][]string) ([]byte, error) {
+	request := map[string]interface{}{"prefix": prefix, "format": "json"}
+	for name, values := range args {
+		request[name] = values
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		panic(fmt.Sprintf("encode command: %v", err))
+	}
+
+	content, err := m.do(ctx, http.MethodPost, "/request?wait=1", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response restfulResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	switch {
+	case response.HasFailed && len(response.Failed) != 0:
+		return nil, fmt.Errorf("command %s failed: %s", prefix, response.Failed[0].Outs)
+	case response.HasFailed:
+		return nil, fmt.Errorf("command %s failed", prefix)
+	case len(response.Finished) == 0:
+		return nil, fmt.Errorf("command %s did not finish", prefix)
+	default:
+		return []byte(response.Finished[0].Outb), nil
+	}
+}
+
+// metrics fetches and parses the metrics of the prometheus module.
+func (m Manager) metrics(ctx context.Context) ([]sample, error) {
+	content, err := m.do(ctx, http.MethodGet, "/metrics", nil)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+
+	return parseSamples(content)
+}
@@ -0,0 +1,159 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+const healthyStatus = `{
+	"health": {"status": "HEALTH_OK", "checks": {}},
+	"osdmap": {"num_osds": 3, "num_up_osds": 3, "num_in_osds": 3},
+	"pgmap": {"num_pgs": 32, "pgs_by_state": [{"state_name": "active+clean", "count": 32}]}
+}`
+
+const usage = `{
+	"stats": {"total_bytes": 1000, "total_used_raw_bytes": 900, "total_used_raw_ratio": 0.9},
+	"pools": [{"name": "rbd", "stats": {"percent_used": 0.2, "max_avail": 100}}]
+}`
+
+// restful returns a stand-in for the restful module that answers commands with the output in outputs.
+func restful(t *testing.T, outputs map[string]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if user, key, ok := request.BasicAuth(); !ok || user != "admin" || key != "secret" {
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if request.Method != http.MethodPost || request.URL.Path != "/request" || request.URL.Query().Get("wait") != "1" {
+			writer.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		var command struct {
+			Prefix string `json:"prefix"`
+			Format string `json:"format"`
+		}
+
+		if err := json.NewDecoder(request.Body).Decode(&command); err != nil || command.Format != "json" {
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		output, ok := outputs[command.Prefix]
+		if !ok {
+			fmt.Fprintf(writer, `{"finished":[],"failed":[{"outs":"unknown command %s"}],"has_failed":true}`, command.Prefix)
+
+			return
+		}
+
+		response := map[string]interface{}{
+			"finished":   []map[string]string{{"outb": output, "outs": ""}},
+			"failed":     []struct{}{},
+			"has_failed": false,
+		}
+
+		if err := json.NewEncoder(writer).Encode(response); err != nil {
+			t.Error(err)
+		}
+	}))
+}
+
+func TestManagerRestful(t *testing.T) {
+	t.Parallel()
+
+	server := restful(t, map[string]string{"status": healthyStatus, "df": usage})
+	defer server.Close()
+
+	maxRawUsed := 0.8
+	check := Check{
+		Manager:  &Manager{URL: server.URL, Module: ModuleRestful, creds: Credentials{User: "admin", Key: "secret"}},
+		Capacity: &Capacity{MaxRawUsed: &maxRawUsed},
+	}
+	rep := &report.Report{}
+
+	err := check.Check(context.Background(), logr.Discard(), rep)
+	if err == nil || !strings.Contains(err.Error(), "raw usage 0.900 above 0.800") {
+		t.Errorf("Check() = %v, want exceeded raw usage", err)
+	}
+
+	if osds := metric(t, rep, "osds"); osds != 3 {
+		t.Errorf("osds = %g, want 3", osds)
+	}
+
+	if _, err := check.command(context.Background(), "pg dump", nil); err == nil ||
+		!strings.Contains(err.Error(), "unknown command pg dump") {
+		t.Errorf("command() = %v, want failure from manager", err)
+	}
+
+	check.Manager.creds.Key = "wrong"
+	if _, err := check.command(context.Background(), "status", nil); err == nil {
+		t.Error("command() succeeded with wrong credentials")
+	}
+}
+
+func TestManagerPrometheus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet || request.URL.Path != "/metrics" {
+			writer.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		fmt.Fprint(writer, prometheusMetrics)
+	}))
+	defer server.Close()
+
+	check := Check{
+		Manager:    &Manager{URL: server.URL + "/", Module: ModulePrometheus},
+		Mute:       []string{"OSD_DOWN"},
+		Thresholds: Thresholds{MaxOSDsDown: intPtr(1), MaxPGsNotClean: intPtr(2)},
+		Capacity:   &Capacity{},
+	}
+
+	if err := check.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := &report.Report{}
+
+	if err := check.Check(context.Background(), logr.Discard(), rep); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+
+	if used := metric(t, rep, "pool rbd: used"); used != 0.5 {
+		t.Errorf("pool rbd used = %g, want 0.5", used)
+	}
+
+	check.Scrub = &Scrub{}
+	if err := check.Setup(); err == nil {
+		t.Error("Setup() accepted scrub ages with the prometheus module")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sample is a single line of the prometheus text format.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// parseSample parses a sample line. Timestamps are ignored.
+func parseSample(line string) (sample, error) {
+	sample := sample{labels: map[string]string{}}
+
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return sample, fmt.Errorf("no value")
+	}
+
+	sample.name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+
+		rest, err = parseLabels(rest[1:], sample.labels)
+		if err != nil {
+			return sample, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("no value")
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("value: %w", err)
+	}
+
+	sample.value = value
+
+	return sample, nil
+}
+
+// parseLabels parses the labels of a sample into dst, starting after the opening brace. It returns the remainder
+// of the line after the closing brace.
+func parseLabels(rest string, dst map[string]string) (string, error) {
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+
+		if strings.HasPrefix(rest, "}") {
+			return rest[1:], nil
+		}
+
+		assign := strings.Index(rest, "=\"")
+		if assign < 0 {
+			return "", fmt.Errorf("malformed labels")
+		}
+
+		name := rest[:assign]
+		rest = rest[assign+2:]
+		value := strings.Builder{}
+
+		for {
+			if rest == "" {
+				return "", fmt.Errorf("unterminated label %s", name)
+			}
+
+			char := rest[0]
+			rest = rest[1:]
+
+			if char == '"' {
+				break
+			}
+
+			if char == '\\' && rest != "" {
+				char = rest[0]
+				rest = rest[1:]
+
+				if char == 'n' {
+					char = '\n'
+				}
+			}
+
+			value.WriteByte(char)
+		}
+
+		dst[name] = value.String()
+	}
+}
+
+// parseSamples parses all samples of a prometheus text format response.
+func parseSamples(content []byte) ([]sample, error) {
+	samples := []sample{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("metrics: %q: %w", line, err)
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+
+	return samples, nil
+}
+
+// prometheusStatus builds the cluster status from the metrics of the prometheus module. The module does not expose
+// messages of health checks and PG states are only known to be clean or not.
+func prometheusStatus(samples []sample) status {
+	var status status
+
+	healthStates := []string{StatusOK, "HEALTH_WARN", "HEALTH_ERR"}
+	status.Health.Checks = map[string]healthCheck{}
+	clean := 0
+
+	for _, sample := range samples {
+		switch sample.name {
+		case "ceph_health_status":
+			if index := int(sample.value); index >= 0 && index < len(healthStates) {
+				status.Health.Status = healthStates[index]
+			}
+		case "ceph_health_detail":
+			if sample.value != 0 {
+				status.Health.Checks[sample.labels["name"]] = healthCheck{Severity: sample.labels["severity"]}
+			}
+		case "ceph_osd_up":
+			status.OSDMap.NumOSDs++
+			status.OSDMap.NumUpOSDs += int(sample.value)
+		case "ceph_osd_in":
+			status.OSDMap.NumInOSDs += int(sample.value)
+		case "ceph_pg_total":
+			status.PGMap.NumPGs += int(sample.value)
+		case "ceph_pg_clean":
+			clean += int(sample.value)
+		}
+	}
+
+	status.PGMap.PGsByState = append(status.PGMap.PGsByState,
+		pgState{StateName: "active+clean", Count: clean},
+		pgState{StateName: "unclean", Count: status.PGMap.NumPGs - clean},
+	)
+
+	return status
+}
+
+// prometheusDF builds the usage from the metrics of the prometheus module.
+func prometheusDF(samples []sample) df {
+	var usage df
+
+	pools := map[string]*dfPool{}
+	pool := func(id string) *dfPool {
+		if _, ok := pools[id]; !ok {
+			pools[id] = &dfPool{Name: id}
+		}
+
+		return pools[id]
+	}
+
+	for _, sample := range samples {
+		switch sample.name {
+		case "ceph_cluster_total_bytes":
+			usage.Stats.TotalBytes = sample.value
+		case "ceph_cluster_total_used_raw_bytes":
+			usage.Stats.TotalUsedRawBytes = sample.value
+		case "ceph_pool_metadata":
+			pool(sample.labels["pool_id"]).Name = sample.labels["name"]
+		case "ceph_pool_percent_used":
+			pool(sample.labels["pool_id"]).Stats.PercentUsed = sample.value
+		case "ceph_pool_max_avail":
+			pool(sample.labels["pool_id"]).Stats.MaxAvail = sample.value
+		}
+	}
+
+	if usage.Stats.TotalBytes != 0 {
+		usage.Stats.TotalUsedRawRatio = usage.Stats.TotalUsedRawBytes / usage.Stats.TotalBytes
+	}
+
+	for _, pool := range pools {
+		usage.Pools = append(usage.Pools, *pool)
+	}
+
+	// Map iteration order varies, keep the pool order of the reports stable.
+	sort.Slice(usage.Pools, func(i, j int) bool { return usage.Pools[i].Name < usage.Pools[j].Name })
+
+	return usage
+}
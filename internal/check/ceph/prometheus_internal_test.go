@@ -0,0 +1,175 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseSample(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line   string
+		name   string
+		labels map[string]string
+		value  float64
+		fail   bool
+	}{
+		{line: "ceph_health_status 1", name: "ceph_health_status", labels: map[string]string{}, value: 1},
+		{line: "ceph_osd_up{ceph_daemon=\"osd.0\"} 1.0 1650000000000", name: "ceph_osd_up",
+			labels: map[string]string{"ceph_daemon": "osd.0"}, value: 1},
+		{line: `ceph_health_detail{name="OSD_DOWN",severity="HEALTH_WARN"} 1.0`, name: "ceph_health_detail",
+			labels: map[string]string{"name": "OSD_DOWN", "severity": "HEALTH_WARN"}, value: 1},
+		{line: `ceph_pool_metadata{name="a\"b\\c\nd", pool_id="1",} 1`, name: "ceph_pool_metadata",
+			labels: map[string]string{"name": "a\"b\\c\nd", "pool_id": "1"}, value: 1},
+		{line: "ceph_health_status", fail: true},
+		{line: "ceph_health_status{} ", fail: true},
+		{line: "ceph_health_status NaNa", fail: true},
+		{line: `ceph_osd_up{ceph_daemon="osd.0} 1`, fail: true},
+		{line: `ceph_osd_up{ceph_daemon} 1`, fail: true},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.line, func(t *testing.T) {
+			t.Parallel()
+
+			sample, err := parseSample(test.line)
+
+			switch {
+			case test.fail && err == nil:
+				t.Fatalf("parseSample() = %+v, want error", sample)
+			case test.fail:
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if sample.name != test.name || sample.value != test.value || len(sample.labels) != len(test.labels) {
+				t.Fatalf("parseSample() = %+v", sample)
+			}
+
+			for name, value := range test.labels {
+				if sample.labels[name] != value {
+					t.Errorf("label %s = %q, want %q", name, sample.labels[name], value)
+				}
+			}
+		})
+	}
+}
+
+const prometheusMetrics = `# HELP ceph_health_status Cluster health status
+# TYPE ceph_health_status untyped
+ceph_health_status 1.0
+ceph_health_detail{name="OSD_DOWN",severity="HEALTH_WARN"} 1.0
+ceph_health_detail{name="MON_DOWN",severity="HEALTH_WARN"} 0.0
+ceph_osd_up{ceph_daemon="osd.0"} 1.0
+ceph_osd_up{ceph_daemon="osd.1"} 0.0
+ceph_osd_up{ceph_daemon="osd.2"} 1.0
+ceph_osd_in{ceph_daemon="osd.0"} 1.0
+ceph_osd_in{ceph_daemon="osd.1"} 1.0
+ceph_osd_in{ceph_daemon="osd.2"} 1.0
+ceph_pg_total{pool_id="1"} 32.0
+ceph_pg_total{pool_id="2"} 32.0
+ceph_pg_clean{pool_id="1"} 32.0
+ceph_pg_clean{pool_id="2"} 30.0
+ceph_cluster_total_bytes 1000.0
+ceph_cluster_total_used_raw_bytes 250.0
+ceph_pool_metadata{pool_id="1",name="rbd"} 1.0
+ceph_pool_percent_used{pool_id="1"} 0.5
+ceph_pool_max_avail{pool_id="1"} 100.0
+`
+
+func TestPrometheusStatus(t *testing.T) {
+	t.Parallel()
+
+	samples, err := parseSamples([]byte(prometheusMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := prometheusStatus(samples)
+
+	if status.Health.Status != "HEALTH_WARN" {
+		t.Errorf("status = %s, want HEALTH_WARN", status.Health.Status)
+	}
+
+	if _, ok := status.Health.Checks["OSD_DOWN"]; !ok || len(status.Health.Checks) != 1 {
+		t.Errorf("checks = %v, want only OSD_DOWN", status.Health.Checks)
+	}
+
+	if osds := status.OSDMap; osds.NumOSDs != 3 || osds.NumUpOSDs != 2 || osds.NumInOSDs != 3 {
+		t.Errorf("osdmap = %+v", osds)
+	}
+
+	if status.PGMap.NumPGs != 64 || status.pgsNotClean() != 2 {
+		t.Errorf("pgs = %d, not clean = %d", status.PGMap.NumPGs, status.pgsNotClean())
+	}
+}
+
+func TestPrometheusDF(t *testing.T) {
+	t.Parallel()
+
+	samples, err := parseSamples([]byte(prometheusMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage := prometheusDF(samples)
+
+	if usage.Stats.TotalUsedRawRatio != 0.25 {
+		t.Errorf("raw ratio = %g, want 0.25", usage.Stats.TotalUsedRawRatio)
+	}
+
+	if len(usage.Pools) != 1 {
+		t.Fatalf("pools = %+v", usage.Pools)
+	}
+
+	if pool := usage.Pools[0]; pool.Name != "rbd" || pool.Stats.PercentUsed != 0.5 || pool.Stats.MaxAvail != 100 {
+		t.Errorf("pool = %+v", pool)
+	}
+}
+
+func TestPrometheusDFPoolOrder(t *testing.T) {
+	t.Parallel()
+
+	samples := []sample{}
+	for id, name := range []string{"rbd", "cephfs_data", "images", ".mgr"} {
+		labels := map[string]string{"pool_id": strconv.Itoa(id), "name": name}
+		samples = append(samples, sample{name: "ceph_pool_metadata", labels: labels, value: 1})
+	}
+
+	usage := prometheusDF(samples)
+
+	names := []string{}
+	for _, pool := range usage.Pools {
+		names = append(names, pool.Name)
+	}
+
+	if got, want := strings.Join(names, ","), ".mgr,cephfs_data,images,rbd"; got != want {
+		t.Errorf("pools = %s, want %s", got, want)
+	}
+}
+
+func TestParseSamplesMalformed(t *testing.T) {
+	t.Parallel()
+
+	if _, err := parseSamples([]byte("ceph_health_status\n")); err == nil {
+		t.Error("parseSamples() accepted a sample without value")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// status is the part of `ceph status -f json` the check evaluates.
+type status struct {
+	Health struct {
+		Status string                 `json:"status"`
+		Checks map[string]healthCheck `json:"checks"`
+	} `json:"health"`
+	OSDMap osdMap `json:"osdmap"`
+	PGMap  struct {
+		NumPGs     int       `json:"num_pgs"`
+		PGsByState []pgState `json:"pgs_by_state"`
+	} `json:"pgmap"`
+}
+
+// pgState is the number of PGs in a combination of states, like active+clean.
+type pgState struct {
+	StateName string `json:"state_name"`
+	Count     int    `json:"count"`
+}
+
+// healthCheck is a single reason for the cluster not being healthy, like OSD_DOWN.
+type healthCheck struct {
+	Severity string `json:"severity"`
+	Summary  struct {
+		Message string `json:"message"`
+	} `json:"summary"`
+	Muted bool `json:"muted"`
+}
+
+// osdMap contains the OSD counts. Older releases nest it into another osdmap object.
+type osdMap struct {
+	NumOSDs   int     `json:"num_osds"`
+	NumUpOSDs int     `json:"num_up_osds"`
+	NumInOSDs int     `json:"num_in_osds"`
+	Nested    *osdMap `json:"osdmap"`
+}
+
+// Thresholds limit the OSDs and PGs that may be unavailable. Unset thresholds are not checked.
+type Thresholds struct {
+	MaxOSDsDown    *int `yaml:"maxOSDsDown"`
+	MaxOSDsOut     *int `yaml:"maxOSDsOut"`
+	MaxPGsNotClean *int `yaml:"maxPGsNotClean"`
+}
+
+// pgsNotClean returns the number of PGs that are not active and clean.
+func (s status) pgsNotClean() int {
+	count := 0
+
+	for _, state := range s.PGMap.PGsByState {
+		parts := strings.Split(state.StateName, "+")
+		active, clean := false, false
+
+		for _, part := range parts {
+			active = active || part == "active"
+			clean = clean || part == "clean"
+		}
+
+		if !active || !clean {
+			count += state.Count
+		}
+	}
+
+	return count
+}
+
+// verify records the OSD and PG counts and compares them against the thresholds.
+func (t Thresholds) verify(s status, rep *report.Report) []string {
+	osds := s.OSDMap
+	if osds.Nested != nil {
+		osds = *osds.Nested
+	}
+
+	down := osds.NumOSDs - osds.NumUpOSDs
+	out := osds.NumOSDs - osds.NumInOSDs
+	notClean := s.pgsNotClean()
+
+	rep.Metric("osds", float64(osds.NumOSDs), "")
+	rep.Metric("osds_down", float64(down), "")
+	rep.Metric("osds_out", float64(out), "")
+	rep.Metric("pgs", float64(s.PGMap.NumPGs), "")
+	rep.Metric("pgs_not_clean", float64(notClean), "")
+
+	problems := []string{}
+
+	if t.MaxOSDsDown != nil && down > *t.MaxOSDsDown {
+		problems = append(problems, fmt.Sprintf("%d osds down, at most %d allowed", down, *t.MaxOSDsDown))
+	}
+
+	if t.MaxOSDsOut != nil && out > *t.MaxOSDsOut {
+		problems = append(problems, fmt.Sprintf("%d osds out, at most %d allowed", out, *t.MaxOSDsOut))
+	}
+
+	if t.MaxPGsNotClean != nil && notClean > *t.MaxPGsNotClean {
+		problems = append(problems, fmt.Sprintf("%d pgs not clean, at most %d allowed", notClean, *t.MaxPGsNotClean))
+	}
+
+	return problems
+}
+
+// decodeStatus decodes the output of `ceph status -f json`.
+func decodeStatus(raw []byte) (status, error) {
+	var status status
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return status, fmt.Errorf("decode status: %w", err)
+	}
+
+	return status, nil
+}
+
+// String formats the health check for messages.
+func (h healthCheck) String() string {
+	if h.Summary.Message == "" {
+		return h.Severity
+	}
+
+	return h.Severity + ": " + h.Summary.Message
+}
+
+// evaluate fails if health checks that are not muted are reported or thresholds are exceeded. Muted health checks
+// are noted in the report.
+func (c Check) evaluate(status status, rep *report.Report) error {
+	if status.Health.Status == "" {
+		return fmt.Errorf("status contains no health")
+	}
+
+	codes := make([]string, 0, len(status.Health.Checks))
+	for code := range status.Health.Checks {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	problems := []string{}
+
+	for _, code := range codes {
+		check := status.Health.Checks[code]
+
+		if check.Muted || c.muted(code) {
+			rep.Note("muted %s (%s)", code, check)
+
+			continue
+		}
+
+		problems = append(problems, fmt.Sprintf("%s (%s)", code, check))
+	}
+
+	if status.Health.Status != StatusOK && len(codes) == 0 {
+		problems = append(problems, status.Health.Status)
+	}
+
+	problems = append(problems, c.Thresholds.verify(status, rep)...)
+
+	if len(problems) != 0 {
+		return fmt.Errorf("ceph reports unhealthy: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// muted returns if the health check with the given code is configured to be ignored.
+func (c Check) muted(code string) bool {
+	for _, muted := range c.Mute {
+		if muted == code {
+			return true
+		}
+	}
+
+	return false
+}
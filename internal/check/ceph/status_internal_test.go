@@ -0,0 +1,149 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ceph
+
+import (
+	"strings"
+	"testing"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// metric returns the value of the named metric in rep.
+func metric(t *testing.T, rep *report.Report, name string) float64 {
+	t.Helper()
+
+	for _, metric := range rep.Metrics() {
+		if metric.Name == name {
+			return metric.Value
+		}
+	}
+
+	t.Fatalf("metric %s missing in %s", name, rep)
+
+	return 0
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+const degradedStatus = `{
+	"health": {
+		"status": "HEALTH_WARN",
+		"checks": {
+			"OSD_DOWN": {"severity": "HEALTH_WARN", "summary": {"message": "1 osds down"}, "muted": false},
+			"POOL_NO_REDUNDANCY": {"severity": "HEALTH_WARN", "summary": {"message": "1 pool"}, "muted": true}
+		}
+	},
+	"osdmap": {"osdmap": {"num_osds": 6, "num_up_osds": 5, "num_in_osds": 6}},
+	"pgmap": {
+		"num_pgs": 129,
+		"pgs_by_state": [
+			{"state_name": "active+clean", "count": 120},
+			{"state_name": "active+undersized+degraded", "count": 8},
+			{"state_name": "peering", "count": 1}
+		]
+	}
+}`
+
+func TestDecodeStatus(t *testing.T) {
+	t.Parallel()
+
+	status, err := decodeStatus([]byte(degradedStatus))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Health.Status != "HEALTH_WARN" || len(status.Health.Checks) != 2 {
+		t.Errorf("health = %+v", status.Health)
+	}
+
+	if status.OSDMap.Nested == nil || status.OSDMap.Nested.NumUpOSDs != 5 {
+		t.Errorf("nested osdmap not decoded: %+v", status.OSDMap)
+	}
+
+	if notClean := status.pgsNotClean(); notClean != 9 {
+		t.Errorf("pgsNotClean() = %d, want 9", notClean)
+	}
+
+	if _, err := decodeStatus([]byte("not json")); err == nil {
+		t.Error("decodeStatus() accepted invalid JSON")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		check    Check
+		problems []string
+	}{
+		{"unmuted check fails", Check{}, []string{"OSD_DOWN"}},
+		{"muted by config", Check{Mute: []string{"OSD_DOWN"}}, nil},
+		{
+			"thresholds exceeded",
+			Check{Mute: []string{"OSD_DOWN"}, Thresholds: Thresholds{MaxOSDsDown: intPtr(0), MaxPGsNotClean: intPtr(5)}},
+			[]string{"1 osds down", "9 pgs not clean"},
+		},
+		{
+			"thresholds kept",
+			Check{Mute: []string{"OSD_DOWN"}, Thresholds: Thresholds{MaxOSDsDown: intPtr(1), MaxOSDsOut: intPtr(0)}},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			status, err := decodeStatus([]byte(degradedStatus))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rep := &report.Report{}
+			err = test.check.evaluate(status, rep)
+
+			if len(test.problems) == 0 && err != nil {
+				t.Fatalf("evaluate() = %v", err)
+			}
+
+			for _, problem := range test.problems {
+				if err == nil || !strings.Contains(err.Error(), problem) {
+					t.Errorf("evaluate() = %v, want %q", err, problem)
+				}
+			}
+
+			if notes := strings.Join(rep.Notes(), "\n"); !strings.Contains(notes, "muted POOL_NO_REDUNDANCY") {
+				t.Errorf("notes = %q, want muted POOL_NO_REDUNDANCY", notes)
+			}
+
+			if down := metric(t, rep, "osds_down"); down != 1 {
+				t.Errorf("osds_down = %g, want 1", down)
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutHealth(t *testing.T) {
+	t.Parallel()
+
+	if err := (Check{}).evaluate(status{}, &report.Report{}); err == nil {
+		t.Error("evaluate() accepted status without health")
+	}
+}
@@ -16,62 +16,138 @@ package check
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"eqrx.net/healthcheck/internal/check/ceph"
+	"eqrx.net/healthcheck/internal/check/domain"
+	"eqrx.net/healthcheck/internal/check/execcheck"
+	"eqrx.net/healthcheck/internal/check/file"
+	"eqrx.net/healthcheck/internal/check/host"
+	"eqrx.net/healthcheck/internal/check/httpcheck"
+	"eqrx.net/healthcheck/internal/check/imap"
 	matrixcheck "eqrx.net/healthcheck/internal/check/matrix"
+	"eqrx.net/healthcheck/internal/check/ntp"
+	"eqrx.net/healthcheck/internal/check/ping"
+	"eqrx.net/healthcheck/internal/check/pop3"
+	"eqrx.net/healthcheck/internal/check/postgres"
+	"eqrx.net/healthcheck/internal/check/redis"
 	"eqrx.net/healthcheck/internal/check/smtp"
+	"eqrx.net/healthcheck/internal/check/sshcheck"
+	"eqrx.net/healthcheck/internal/check/systemd"
+	"eqrx.net/healthcheck/internal/check/tcp"
+	"eqrx.net/healthcheck/internal/report"
 	"eqrx.net/healthcheck/internal/sink"
 	"eqrx.net/rungroup"
 	"github.com/go-logr/logr"
 )
 
+var errConcrete = errors.New("more or less than one concrete types set for check")
+
+// concrete is implemented by all check types.
+type concrete interface {
+	Check(ctx context.Context, log logr.Logger, rep *report.Report) error
+}
+
+// setupper is implemented by check types that need to be prepared before they are run.
+type setupper interface {
+	Setup() error
+}
+
 // Check contains concrete check implementations.
 type Check struct {
-	Matrix   *matrixcheck.Check                       `yaml:"matrix"`
-	SMTP     *smtp.Check                              `yaml:"smtp"`
-	Ceph     *ceph.Check                              `yaml:"ceph"`
-	Sinks    []sink.Sink                              `yaml:"sinks"`
-	Interval time.Duration                            `yaml:"interval"`
-	Name     string                                   `yaml:"name"`
-	checkCB  func(context.Context, logr.Logger) error `yaml:"-"`
+	Matrix   *matrixcheck.Check                                       `yaml:"matrix"`
+	SMTP     *smtp.Check                                              `yaml:"smtp"`
+	MailAuth *smtp.MailAuth                                           `yaml:"mailauth"`
+	IMAP     *imap.Check                                              `yaml:"imap"`
+	POP3     *pop3.Check                                              `yaml:"pop3"`
+	Ceph     *ceph.Check                                              `yaml:"ceph"`
+	HTTP     *httpcheck.Check                                         `yaml:"http"`
+	TCP      *tcp.Check                                               `yaml:"tcp"`
+	TLS      *tcp.TLSCheck                                            `yaml:"tls"`
+	ICMP     *ping.Check                                              `yaml:"icmp"`
+	Exec     *execcheck.Check                                         `yaml:"exec"`
+	Systemd  *systemd.Check                                           `yaml:"systemd"`
+	Host     *host.Check                                              `yaml:"host"`
+	File     *file.Check                                              `yaml:"file"`
+	Postgres *postgres.Check                                          `yaml:"postgres"`
+	Redis    *redis.Check                                             `yaml:"redis"`
+	SSH      *sshcheck.Check                                          `yaml:"ssh"`
+	Domain   *domain.Check                                            `yaml:"domain"`
+	NTP      *ntp.Check                                               `yaml:"ntp"`
+	Sinks    []sink.Sink                                              `yaml:"sinks"`
+	Interval time.Duration                                            `yaml:"interval"`
+	Name     string                                                   `yaml:"name"`
+	checkCB  func(context.Context, logr.Logger, *report.Report) error `yaml:"-"`
 }
 
-// Setup starts the check.
-func (c *Check) Setup(ctx context.Context, group *rungroup.Group, log logr.Logger) error {
-	if c.Matrix != nil {
-		if c.checkCB != nil {
-			return fmt.Errorf("more or less than one concrete types set for check")
-		}
+// concrete returns the name and implementation of the only concrete check type that is set.
+func (c *Check) concrete() (string, concrete, error) {
+	candidates := []struct {
+		name string
+		set  bool
+		impl concrete
+	}{
+		{"matrix", c.Matrix != nil, c.Matrix},
+		{"smtp", c.SMTP != nil, c.SMTP},
+		{"mailauth", c.MailAuth != nil, c.MailAuth},
+		{"imap", c.IMAP != nil, c.IMAP},
+		{"pop3", c.POP3 != nil, c.POP3},
+		{"ceph", c.Ceph != nil, c.Ceph},
+		{"http", c.HTTP != nil, c.HTTP},
+		{"tcp", c.TCP != nil, c.TCP},
+		{"tls", c.TLS != nil, c.TLS},
+		{"icmp", c.ICMP != nil, c.ICMP},
+		{"exec", c.Exec != nil, c.Exec},
+		{"systemd", c.Systemd != nil, c.Systemd},
+		{"host", c.Host != nil, c.Host},
+		{"file", c.File != nil, c.File},
+		{"postgres", c.Postgres != nil, c.Postgres},
+		{"redis", c.Redis != nil, c.Redis},
+		{"ssh", c.SSH != nil, c.SSH},
+		{"domain", c.Domain != nil, c.Domain},
+		{"ntp", c.NTP != nil, c.NTP},
+	}
 
-		c.Matrix.Setup()
+	var name string
 
-		c.checkCB = c.Matrix.Check
-	}
+	var impl concrete
 
-	if c.SMTP != nil {
-		if c.checkCB != nil {
-			return fmt.Errorf("more or less than one concrete types set for check")
+	for _, candidate := range candidates {
+		if !candidate.set {
+			continue
 		}
 
-		c.SMTP.Setup()
+		if impl != nil {
+			return "", nil, errConcrete
+		}
 
-		c.checkCB = c.SMTP.Check
+		name, impl = candidate.name, candidate.impl
 	}
 
-	if c.Ceph != nil {
-		if c.checkCB != nil {
-			return fmt.Errorf("more or less than one concrete types set for check")
-		}
+	if impl == nil {
+		return "", nil, errConcrete
+	}
 
-		c.checkCB = c.Ceph.Check
+	return name, impl, nil
+}
+
+// Setup starts the check.
+func (c *Check) Setup(ctx context.Context, group *rungroup.Group, log logr.Logger) error {
+	name, impl, err := c.concrete()
+	if err != nil {
+		return err
 	}
 
-	if c.checkCB == nil {
-		return fmt.Errorf("more or less than one concrete types set for check")
+	if setupper, ok := impl.(setupper); ok {
+		if err := setupper.Setup(); err != nil {
+			return fmt.Errorf("%s setup: %w", name, err)
+		}
 	}
 
+	c.checkCB = impl.Check
+
 	for i := range c.Sinks {
 		if err := c.Sinks[i].Setup(ctx, c.Name); err != nil {
 			return fmt.Errorf("setup sink: %w", err)
@@ -92,7 +168,8 @@ func (c Check) poll(ctx context.Context, log logr.Logger, interval time.Duration
 	defer ticker.Stop()
 
 	for {
-		checkErr := c.check(ctx, log)
+		rep := &report.Report{}
+		checkErr := c.check(ctx, log, rep)
 
 		select {
 		case <-ctx.Done():
@@ -100,7 +177,7 @@ func (c Check) poll(ctx context.Context, log logr.Logger, interval time.Duration
 		default:
 		}
 
-		if err := c.sink(ctx, checkErr); err != nil {
+		if err := c.sink(ctx, rep, checkErr); err != nil {
 			log.Error(err, "sinks error")
 		}
 
@@ -112,16 +189,30 @@ func (c Check) poll(ctx context.Context, log logr.Logger, interval time.Duration
 	}
 }
 
-func (c Check) check(ctx context.Context, log logr.Logger) error {
+func (c Check) check(ctx context.Context, log logr.Logger, rep *report.Report) error {
 	timeout := c.Interval / 2
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 
 	defer cancel()
 
-	return c.checkCB(ctx, log)
+	err := c.checkCB(ctx, log, rep)
+
+	for _, warning := range rep.Warnings() {
+		log.Info("warning", "check", c.Name, "warning", warning)
+	}
+
+	for _, note := range rep.Notes() {
+		log.Info("note", "check", c.Name, "note", note)
+	}
+
+	for _, metric := range rep.Metrics() {
+		log.Info("metric", "check", c.Name, "name", metric.Name, "value", metric.Value, "unit", metric.Unit)
+	}
+
+	return err
 }
 
-func (c Check) sink(ctx context.Context, checkErr error) error {
+func (c Check) sink(ctx context.Context, rep *report.Report, checkErr error) error {
 	timeout := c.Interval / 2
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 
@@ -132,7 +223,7 @@ func (c Check) sink(ctx context.Context, checkErr error) error {
 	for i := range c.Sinks {
 		sink := &c.Sinks[i]
 
-		group.Go(func(ctx context.Context) error { return sink.Sink(ctx, checkErr) }, rungroup.NeverCancel)
+		group.Go(func(ctx context.Context) error { return sink.Sink(ctx, rep, checkErr) }, rungroup.NeverCancel)
 	}
 
 	if err := group.Wait(); err != nil {
@@ -0,0 +1,252 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package domain contains a health check for domain registrations.
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+	"github.com/miekg/dns"
+)
+
+// defaultExpiryWarning is how long before its expiry a registration is warned about if nothing else is configured.
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// Check queries the registration of a domain via RDAP. The service is looked up in the IANA bootstrap registry unless
+// RDAP is set to its HTTP(S) base URL. The registration must not be expired or on hold and is warned about
+// ExpiryWarning before its expiry. All registered nameservers must answer authoritatively with exactly the registered
+// NS set. AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool              `yaml:"ipv4"`
+	AddressFamilies    string            `yaml:"addressFamilies"`
+	RequireAllFamilies bool              `yaml:"requireAllFamilies"`
+	Domain             string            `yaml:"domain"`
+	RDAP               string            `yaml:"rdap"`
+	ExpiryWarning      time.Duration     `yaml:"expiryWarning"`
+	families           []netcheck.Family `yaml:"-"`
+	targetRRType       uint16            `yaml:"-"`
+	network            string            `yaml:"-"`
+}
+
+// Setup prepares often used values.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Domain == "" {
+		return fmt.Errorf("no domain given")
+	}
+
+	c.Domain = strings.ToLower(strings.TrimSuffix(c.Domain, "."))
+
+	if c.ExpiryWarning == 0 {
+		c.ExpiryWarning = defaultExpiryWarning
+	}
+
+	if c.RDAP != "" {
+		parsed, err := url.Parse(c.RDAP)
+		if err != nil {
+			return fmt.Errorf("rdap: %w", err)
+		}
+
+		if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return fmt.Errorf("rdap: %s is no HTTP(S) URL", c.RDAP)
+		}
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// inactive returns if the RDAP status belongs to a registration that does not resolve anymore.
+func inactive(status string) bool {
+	switch strings.ToLower(status) {
+	case "client hold", "server hold", "redemption period", "pending delete", "inactive":
+		return true
+	default:
+		return false
+	}
+}
+
+// Check looks up the registration of the domain and verifies its expiry, status and delegation.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	reg, err := c.lookup(ctx)
+	if err != nil {
+		return fmt.Errorf("domain check: %w", err)
+	}
+
+	if err := c.verifyRegistration(reg, rep); err != nil {
+		return fmt.Errorf("domain check: %w", err)
+	}
+
+	nameservers := []string{}
+	for _, nameserver := range reg.Nameservers {
+		nameservers = append(nameservers, normalize(nameserver.LDHName))
+	}
+
+	if len(nameservers) == 0 {
+		return fmt.Errorf("domain check: no nameservers registered")
+	}
+
+	sort.Strings(nameservers)
+
+	err = netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).verifyDelegation(ctx, nameservers)
+		})
+	if err != nil {
+		return fmt.Errorf("domain check: %w", err)
+	}
+
+	rep.Metric("nameservers", float64(len(nameservers)), "")
+
+	return nil
+}
+
+// verifyRegistration checks the status and the expiration date of the registration.
+func (c Check) verifyRegistration(reg registration, rep *report.Report) error {
+	for _, status := range reg.Status {
+		if inactive(status) {
+			return fmt.Errorf("registration status %s", status)
+		}
+	}
+
+	expiration, ok := reg.expiration()
+	if !ok {
+		rep.Warn("no expiration date registered")
+
+		return nil
+	}
+
+	remaining := time.Until(expiration)
+
+	rep.Metric("domain_expiry_days", remaining.Hours()/24, "d")
+
+	if remaining <= 0 {
+		return fmt.Errorf("registration expired at %s", expiration.Format(time.RFC3339))
+	}
+
+	if remaining < c.ExpiryWarning {
+		rep.Warn("registration expires at %s", expiration.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// normalize returns name in lower case without trailing dot.
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// nameserverAddr is an address of a registered nameserver.
+type nameserverAddr struct {
+	nameserver string
+	hostPort   string
+}
+
+// verifyDelegation queries all addresses of the registered nameservers for the NS records of the domain. All
+// nameservers are resolved before the first one is queried. The registered nameservers have to be sorted.
+func (c Check) verifyDelegation(ctx context.Context, nameservers []string) error {
+	targets := []nameserverAddr{}
+
+	for _, nameserver := range nameservers {
+		addrs, err := netcheck.Resolve(ctx, nameserver, c.targetRRType)
+		if err != nil {
+			return fmt.Errorf("resolve nameserver %s: %w", nameserver, err)
+		}
+
+		for i := range addrs {
+			targets = append(targets, nameserverAddr{nameserver, net.JoinHostPort(addrs[i].String(), "53")})
+		}
+	}
+
+	if len(targets) == 0 {
+		return fmt.Errorf("nameservers: %w", netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range targets {
+		target := targets[i]
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.verifyNameserver(ctx, target.hostPort, nameservers); err != nil {
+				return fmt.Errorf("nameserver %s (%s): %w", target.nameserver, target.hostPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+// verifyNameserver asks the nameserver at addr for the NS records of the domain and compares them with the registered
+// set, which has to be sorted.
+func (c Check) verifyNameserver(ctx context.Context, addr string, registered []string) error {
+	question := (&dns.Msg{}).SetQuestion(dns.Fqdn(c.Domain), dns.TypeNS)
+	question.RecursionDesired = false
+
+	answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, addr)
+	if err != nil {
+		return fmt.Errorf("dns exchange: %w", err)
+	}
+
+	if answer.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("answered %s", dns.RcodeToString[answer.Rcode])
+	}
+
+	if !answer.Authoritative {
+		return fmt.Errorf("answer not authoritative")
+	}
+
+	served := []string{}
+
+	for i := range answer.Answer {
+		if record, ok := answer.Answer[i].(*dns.NS); ok {
+			served = append(served, normalize(record.Ns))
+		}
+	}
+
+	sort.Strings(served)
+
+	if strings.Join(served, " ") != strings.Join(registered, " ") {
+		return fmt.Errorf("serves NS %s, registered are %s", strings.Join(served, ", "), strings.Join(registered, ", "))
+	}
+
+	return nil
+}
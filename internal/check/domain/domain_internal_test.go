@@ -0,0 +1,112 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+func TestSetup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rdap  string
+		valid bool
+	}{
+		{"", true},
+		{"https://rdap.example/", true},
+		{"http://127.0.0.1:8080/rdap", true},
+		{"rdap.example", false},
+		{"ftp://rdap.example/", false},
+		{"https://", false},
+		{"https://exa mple/", false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.rdap, func(t *testing.T) {
+			t.Parallel()
+
+			check := Check{Domain: "Example.COM.", RDAP: test.rdap}
+			err := check.Setup()
+
+			switch {
+			case test.valid && err != nil:
+				t.Errorf("Setup() = %v", err)
+			case !test.valid && err == nil:
+				t.Error("Setup() accepted invalid RDAP URL")
+			case test.valid && check.Domain != "example.com":
+				t.Errorf("domain = %s, want example.com", check.Domain)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	t.Parallel()
+
+	expiringIn := func(remaining time.Duration) registration {
+		reg := registration{Status: []string{"active", "client transfer prohibited"}}
+		reg.Events = append(reg.Events, struct {
+			Action string    `json:"eventAction"`
+			Date   time.Time `json:"eventDate"`
+		}{"expiration", time.Now().Add(remaining)})
+
+		return reg
+	}
+
+	onHold := expiringIn(time.Hour * 24 * 365)
+	onHold.Status = append(onHold.Status, "Client Hold")
+
+	tests := []struct {
+		name    string
+		reg     registration
+		problem string
+		warning string
+	}{
+		{"valid", expiringIn(time.Hour * 24 * 365), "", ""},
+		{"expiring", expiringIn(time.Hour * 24), "", "registration expires at"},
+		{"expired", expiringIn(-time.Hour), "registration expired at", ""},
+		{"on hold", onHold, "registration status Client Hold", ""},
+		{"no expiration", registration{}, "", "no expiration date registered"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			rep := &report.Report{}
+			err := Check{ExpiryWarning: defaultExpiryWarning}.verifyRegistration(test.reg, rep)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("verifyRegistration() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("verifyRegistration() = %v, want %q", err, test.problem)
+			}
+
+			if warnings := strings.Join(rep.Warnings(), "\n"); !strings.Contains(warnings, test.warning) ||
+				(test.warning == "" && warnings != "") {
+				t.Errorf("warnings = %q, want %q", warnings, test.warning)
+			}
+		})
+	}
+}
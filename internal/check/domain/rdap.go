@@ -0,0 +1,165 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// bootstrapURL is the IANA registry of RDAP services responsible for top level domains.
+	bootstrapURL = "https://data.iana.org/rdap/dns.json"
+	// responseLimit is the maximum size of RDAP responses.
+	responseLimit = 1024 * 1024
+)
+
+// bootstrap is the IANA RDAP bootstrap registry as defined by RFC 9224.
+type bootstrap struct {
+	Services [][][]string `json:"services"`
+}
+
+// registration is the part of an RDAP domain object as defined by RFC 9083 that is checked.
+type registration struct {
+	LDHName string   `json:"ldhName"`
+	Status  []string `json:"status"`
+	Events  []struct {
+		Action string    `json:"eventAction"`
+		Date   time.Time `json:"eventDate"`
+	} `json:"events"`
+	Nameservers []struct {
+		LDHName string `json:"ldhName"`
+	} `json:"nameservers"`
+}
+
+// expiration returns the expiration date of the registration.
+func (r registration) expiration() (time.Time, bool) {
+	for _, event := range r.Events {
+		if event.Action == "expiration" {
+			return event.Date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (c Check) httpClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			IdleConnTimeout: 1 * time.Second,
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, c.network, addr)
+			},
+		},
+	}
+}
+
+// load fetches url and decodes the JSON response into dst.
+func (c Check) load(ctx context.Context, url string, dst interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create http request: %w", err)
+	}
+
+	request.Header.Set("Accept", "application/rdap+json, application/json")
+
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return fmt.Errorf("execute http request: %w", err)
+	}
+
+	readErr := json.NewDecoder(io.LimitReader(response.Body, responseLimit)).Decode(dst)
+
+	closeErr := response.Body.Close()
+
+	switch {
+	case response.StatusCode < 200 || response.StatusCode >= 300:
+		return fmt.Errorf("unexpected http response status: %v", response.StatusCode)
+	case readErr != nil:
+		return fmt.Errorf("read body: %w", readErr)
+	case closeErr != nil:
+		return fmt.Errorf("close body: %w", closeErr)
+	default:
+		return nil
+	}
+}
+
+// service returns the base URL of the HTTPS RDAP service responsible for domain, chosen by the longest suffix of the
+// domain in the registry. It returns an empty string if no service is responsible.
+func (b bootstrap) service(domain string) string {
+	base, matched := "", ""
+
+	for _, service := range b.Services {
+		if len(service) != 2 {
+			continue
+		}
+
+		for _, suffix := range service[0] {
+			if !strings.HasSuffix(domain, "."+suffix) || len(suffix) <= len(matched) {
+				continue
+			}
+
+			for _, url := range service[1] {
+				if strings.HasPrefix(url, "https://") {
+					base, matched = url, suffix
+				}
+			}
+		}
+	}
+
+	return base
+}
+
+// rdapBase returns the base URL of the RDAP service responsible for the domain. The configured one is used if given,
+// else it is looked up in the bootstrap registry.
+func (c Check) rdapBase(ctx context.Context) (string, error) {
+	if c.RDAP != "" {
+		return c.RDAP, nil
+	}
+
+	var registry bootstrap
+
+	if err := c.load(ctx, bootstrapURL, &registry); err != nil {
+		return "", fmt.Errorf("bootstrap: %w", err)
+	}
+
+	base := registry.service(c.Domain)
+	if base == "" {
+		return "", fmt.Errorf("bootstrap: no RDAP service for %s", c.Domain)
+	}
+
+	return base, nil
+}
+
+// lookup queries the registration of the domain.
+func (c Check) lookup(ctx context.Context) (registration, error) {
+	base, err := c.rdapBase(ctx)
+	if err != nil {
+		return registration{}, err
+	}
+
+	var reg registration
+
+	if err := c.load(ctx, strings.TrimSuffix(base, "/")+"/domain/"+c.Domain, &reg); err != nil {
+		return registration{}, fmt.Errorf("rdap: %w", err)
+	}
+
+	return reg, nil
+}
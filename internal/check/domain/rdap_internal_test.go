@@ -0,0 +1,111 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBootstrapService(t *testing.T) {
+	t.Parallel()
+
+	registry := bootstrap{Services: [][][]string{
+		{{"com", "net"}, {"http://rdap.example/com/", "https://rdap.example/com/"}},
+		{{"uk"}, {"https://rdap.example/uk/"}},
+		{{"co.uk"}, {"https://rdap.example/co.uk/"}},
+		{{"org"}, {"http://rdap.example/org/"}},
+		{{"broken"}},
+	}}
+
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "https://rdap.example/com/"},
+		{"sub.example.net", "https://rdap.example/com/"},
+		{"example.uk", "https://rdap.example/uk/"},
+		{"example.co.uk", "https://rdap.example/co.uk/"},
+		{"example.org", ""},
+		{"example.broken", ""},
+		{"examplecom", ""},
+		{"com", ""},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.domain, func(t *testing.T) {
+			t.Parallel()
+
+			if base := registry.service(test.domain); base != test.want {
+				t.Errorf("service() = %q, want %q", base, test.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/rdap/domain/example.com" {
+			writer.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		fmt.Fprint(writer, `{"ldhName": "example.com", "status": ["active"],
+			"events": [{"eventAction": "expiration", "eventDate": "2099-01-01T00:00:00Z"}],
+			"nameservers": [{"ldhName": "ns1.example.net."}]}`)
+	}))
+	defer server.Close()
+
+	check := Check{IPV4: true, Domain: "example.com", RDAP: server.URL + "/rdap/"}
+	if err := check.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := check.lookup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expiration, ok := reg.expiration(); !ok || expiration.Year() != 2099 {
+		t.Errorf("expiration = %s, %t", expiration, ok)
+	}
+
+	if len(reg.Nameservers) != 1 || reg.Nameservers[0].LDHName != "ns1.example.net." {
+		t.Errorf("nameservers = %+v", reg.Nameservers)
+	}
+
+	check.Domain = "example.org"
+	if _, err := check.lookup(context.Background()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("lookup() = %v, want status error", err)
+	}
+}
+
+func TestLoadInvalidURL(t *testing.T) {
+	t.Parallel()
+
+	var reg registration
+
+	if err := (Check{}).load(context.Background(), "https://exa mple.com/", &reg); err == nil {
+		t.Error("load() accepted an invalid URL")
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package execcheck contains a health check that runs a program like a Nagios plugin.
+package execcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+)
+
+// defaultTimeout is how long the program may run if nothing else is configured.
+const defaultTimeout = 30 * time.Second
+
+// Exit codes of Nagios plugins.
+const (
+	exitOK       = 0
+	exitWarning  = 1
+	exitCritical = 2
+	exitUnknown  = 3
+)
+
+// Check runs a program and interprets its exit code and output as Nagios plugins do. Warnings are reported and do
+// not fail the check, critical and unknown states do. Perfdata is reported as metrics. Env is added to the
+// environment of the healthcheck process.
+type Check struct {
+	Command []string          `yaml:"command"`
+	Env     map[string]string `yaml:"env"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+// Setup validates the command and fills in defaults.
+func (c *Check) Setup() error {
+	if len(c.Command) == 0 {
+		return fmt.Errorf("no command given")
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+
+	return nil
+}
+
+// environment returns the environment of the process extended by the configured variables.
+func (c Check) environment() []string {
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	env := os.Environ()
+	for _, name := range names {
+		env = append(env, name+"="+c.Env[name])
+	}
+
+	return env
+}
+
+// run executes the command in its own process group and returns its standard output. The output is read while the
+// command runs. Once the command exits or ctx is done the group is killed, so children that keep the output open do
+// not block the check.
+func (c Check) run(ctx context.Context) (string, error) {
+	cmd := exec.Command(c.Command[0], c.Command[1:]...) //nolint:gosec // Running it is the purpose of the check.
+	cmd.Env = c.environment()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("start: %w", err)
+	}
+
+	var (
+		state   *os.ProcessState
+		waitErr error
+		output  []byte
+	)
+
+	group := rungroup.New(ctx)
+
+	group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("kill: %w", err)
+		}
+
+		return nil
+	})
+
+	group.Go(func(context.Context) error {
+		state, waitErr = cmd.Process.Wait()
+
+		return nil
+	})
+
+	group.Go(func(context.Context) error {
+		var err error
+
+		output, err = io.ReadAll(stdout)
+		if err != nil {
+			return fmt.Errorf("read stdout: %w", err)
+		}
+
+		return nil
+	}, rungroup.NeverCancel)
+
+	err = group.Wait()
+
+	if closeErr := stdout.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("close stdout: %w", closeErr)
+	}
+
+	switch {
+	case err != nil:
+		return "", err
+	case waitErr != nil:
+		return "", fmt.Errorf("wait: %w", waitErr)
+	case !state.Success():
+		return string(output), &exec.ExitError{ProcessState: state}
+	default:
+		return string(output), nil
+	}
+}
+
+// Check runs the command and evaluates its result.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	stdout, err := c.run(ctx)
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("exec %s: timed out after %s", c.Command[0], c.Timeout)
+	}
+
+	code := exitOK
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		return fmt.Errorf("exec %s: %w", c.Command[0], err)
+	}
+
+	text, perfdata := parseOutput(stdout)
+
+	for _, metric := range perfdata {
+		rep.Metric(metric.Name, metric.Value, metric.Unit)
+	}
+
+	switch code {
+	case exitOK:
+		return nil
+	case exitWarning:
+		rep.Warn("%s", text)
+
+		return nil
+	case exitCritical:
+		return fmt.Errorf("critical: %s", text)
+	case exitUnknown:
+		return fmt.Errorf("unknown: %s", text)
+	default:
+		return fmt.Errorf("exit code %d: %s", code, text)
+	}
+}
+
+// parseOutput splits the plugin output into its first line of text and the perfdata. Perfdata follows a pipe on the
+// first line and the first pipe of the remaining lines, all other text after the first line is ignored.
+func parseOutput(output string) (string, []report.Metric) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	text, perfdata, _ := strings.Cut(lines[0], "|")
+
+	for _, line := range lines[1:] {
+		if _, more, found := strings.Cut(line, "|"); found {
+			perfdata += " " + more
+		}
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		text = "no output"
+	}
+
+	return text, parsePerfdata(perfdata)
+}
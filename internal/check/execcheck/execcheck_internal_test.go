@@ -0,0 +1,95 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package execcheck
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		script  string
+		problem string
+		warning string
+	}{
+		{"ok", "echo 'fine | load=0.5;1;2'", "", ""},
+		{"warning", "echo 'disk almost full'; exit 1", "", "disk almost full"},
+		{"critical", "echo 'disk full'; exit 2", "critical: disk full", ""},
+		{"unknown", "exit 3", "unknown: no output", ""},
+		{"other code", "echo broken; exit 7", "exit code 7: broken", ""},
+		{"background child", "sleep 30 & echo started", "", ""},
+		{"large output", "head -c 1000000 /dev/zero", "", ""},
+		{"timeout", "sleep 30", "timed out", ""},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			check := Check{Command: []string{"/bin/sh", "-c", test.script}, Timeout: 2 * time.Second}
+			rep := &report.Report{}
+			start := time.Now()
+
+			err := check.Check(context.Background(), logr.Discard(), rep)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("Check() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("Check() = %v, want %q", err, test.problem)
+			}
+
+			if warnings := strings.Join(rep.Warnings(), "\n"); warnings != test.warning {
+				t.Errorf("warnings = %q, want %q", warnings, test.warning)
+			}
+
+			if elapsed := time.Since(start); test.problem != "timed out" && elapsed > time.Second {
+				t.Errorf("Check() took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	t.Parallel()
+
+	text, metrics := parseOutput("DISK OK - free space | /=2643MB;5948;5958;0;5968\n/ 15272 MB (77%);\n" +
+		"/boot 68 MB (69%) | /boot=68MB;88;93;0;98\n'home dir'=69%;99 'it''s'=U\n")
+
+	if text != "DISK OK - free space" {
+		t.Errorf("text = %q", text)
+	}
+
+	want := []report.Metric{{Name: "/", Value: 2643, Unit: "MB"}, {Name: "/boot", Value: 68, Unit: "MB"}}
+	if len(metrics) != len(want) {
+		t.Fatalf("metrics = %+v, want %+v", metrics, want)
+	}
+
+	for i := range want {
+		if metrics[i] != want[i] {
+			t.Errorf("metric %d = %+v, want %+v", i, metrics[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package execcheck
+
+import (
+	"strconv"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// splitPerfdata splits perfdata into its space separated entries. Labels may be quoted with single quotes to contain
+// spaces, two single quotes within them stand for one.
+func splitPerfdata(perfdata string) []string {
+	entries := []string{}
+	entry := strings.Builder{}
+	quoted := false
+
+	for i := 0; i < len(perfdata); i++ {
+		char := perfdata[i]
+
+		switch {
+		case char == '\'' && quoted && i+1 < len(perfdata) && perfdata[i+1] == '\'':
+			entry.WriteByte(char)
+			i++
+		case char == '\'':
+			quoted = !quoted
+		case char == ' ' && !quoted:
+			if entry.Len() != 0 {
+				entries = append(entries, entry.String())
+				entry.Reset()
+			}
+		default:
+			entry.WriteByte(char)
+		}
+	}
+
+	if entry.Len() != 0 {
+		entries = append(entries, entry.String())
+	}
+
+	return entries
+}
+
+// parsePerfdata parses perfdata of the form label=value[UOM];[warn];[crit];[min];[max]. Only label, value and unit
+// are kept. Entries that are malformed or whose value is undetermined are skipped.
+func parsePerfdata(perfdata string) []report.Metric {
+	metrics := []report.Metric{}
+
+	for _, entry := range splitPerfdata(perfdata) {
+		label, rest, found := strings.Cut(entry, "=")
+		if !found || label == "" {
+			continue
+		}
+
+		value, _, _ := strings.Cut(rest, ";")
+
+		end := strings.IndexFunc(value, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+' && r != 'e' && r != 'E'
+		})
+		if end < 0 {
+			end = len(value)
+		}
+
+		number, err := strconv.ParseFloat(value[:end], 64)
+		if err != nil {
+			continue
+		}
+
+		metrics = append(metrics, report.Metric{Name: label, Value: number, Unit: value[end:]})
+	}
+
+	return metrics
+}
@@ -0,0 +1,237 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package file contains a health check for the freshness of files like backups.
+package file
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// Check asserts that Path, which may be a glob, matches at least one regular file and verifies the newest match.
+// It needs to be younger than MaxAge and at least MinSize bytes large. If given, its SHA-256 checksum needs to
+// equal SHA256 or the checksum in the file named like it with ChecksumSuffix appended, which is in the format of
+// sha256sum. If given, its content needs to match Regex. Zero limits are not checked.
+type Check struct {
+	Path           string         `yaml:"path"`
+	MaxAge         time.Duration  `yaml:"maxAge"`
+	MinSize        int64          `yaml:"minSize"`
+	SHA256         string         `yaml:"sha256"`
+	ChecksumSuffix string         `yaml:"checksumSuffix"`
+	Regex          string         `yaml:"regex"`
+	regex          *regexp.Regexp `yaml:"-"`
+}
+
+// Setup validates the path and compiles the regex.
+func (c *Check) Setup() error {
+	if c.Path == "" {
+		return fmt.Errorf("no path given")
+	}
+
+	if _, err := filepath.Match(c.Path, ""); err != nil {
+		return fmt.Errorf("path: %w", err)
+	}
+
+	if c.SHA256 != "" && c.ChecksumSuffix != "" {
+		return fmt.Errorf("sha256 and checksumSuffix are mutually exclusive")
+	}
+
+	c.SHA256 = strings.ToLower(c.SHA256)
+
+	if c.Regex != "" {
+		regex, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return fmt.Errorf("regex: %w", err)
+		}
+
+		c.regex = regex
+	}
+
+	return nil
+}
+
+// newest returns the path and info of the most recently modified regular file matching the path.
+func (c Check) newest() (string, os.FileInfo, error) {
+	matches, err := filepath.Glob(c.Path)
+	if err != nil {
+		return "", nil, fmt.Errorf("glob: %w", err)
+	}
+
+	var newestPath string
+
+	var newestInfo os.FileInfo
+
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since globbing, for example by backup rotation.
+			continue
+		}
+
+		if err != nil {
+			return "", nil, fmt.Errorf("stat: %w", err)
+		}
+
+		if info.Mode().IsRegular() && (newestInfo == nil || info.ModTime().After(newestInfo.ModTime())) {
+			newestPath, newestInfo = match, info
+		}
+	}
+
+	if newestInfo == nil {
+		return "", nil, fmt.Errorf("no file matches %s", c.Path)
+	}
+
+	return newestPath, newestInfo, nil
+}
+
+// contextReader stops reading once its context is done. It keeps the first read error since regexp.MatchReader
+// treats errors like the end of the input.
+type contextReader struct {
+	ctx    context.Context //nolint:containedctx // Read has no context parameter.
+	reader io.Reader
+	err    error
+}
+
+// Read reads from the underlying reader if the context is not done yet.
+func (r *contextReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		r.err = err
+
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// expectedChecksum returns the configured checksum or the one read from the checksum file of path.
+func (c Check) expectedChecksum(ctx context.Context, path string) (string, error) {
+	if c.ChecksumSuffix == "" {
+		return c.SHA256, nil
+	}
+
+	file, err := os.Open(path + c.ChecksumSuffix)
+	if err != nil {
+		return "", fmt.Errorf("checksum file: %w", err)
+	}
+
+	defer file.Close()
+
+	content, err := io.ReadAll(&contextReader{ctx: ctx, reader: file})
+	if err != nil {
+		return "", fmt.Errorf("checksum file: %w", err)
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file: empty")
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+// verifyContent reads the file once to verify its checksum and content.
+func (c Check) verifyContent(ctx context.Context, path string) error {
+	expected, err := c.expectedChecksum(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if expected == "" && c.regex == nil {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+	source := &contextReader{ctx: ctx, reader: file}
+	reader := bufio.NewReader(io.TeeReader(source, hash))
+
+	if c.regex != nil && !c.regex.MatchReader(reader) {
+		if source.err != nil {
+			return fmt.Errorf("read: %w", source.err)
+		}
+
+		return fmt.Errorf("content does not match %s", c.Regex)
+	}
+
+	if expected == "" {
+		return nil
+	}
+
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum %s does not match %s", actual, expected)
+	}
+
+	return nil
+}
+
+// Check finds the newest matching file and verifies it.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	path, info, err := c.newest()
+	if err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+
+	age := time.Since(info.ModTime())
+
+	rep.Note("newest %s", path)
+	rep.Metric("age", age.Hours(), "h")
+	rep.Metric("size", float64(info.Size()), "B")
+
+	if c.MaxAge != 0 && age > c.MaxAge {
+		return fmt.Errorf("file: %s modified %s ago", path, age.Round(time.Second))
+	}
+
+	if info.Size() < c.MinSize {
+		return fmt.Errorf("file: %s has %d bytes, less than %d", path, info.Size(), c.MinSize)
+	}
+
+	if err := c.verifyContent(ctx, path); err != nil {
+		return fmt.Errorf("file: %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// writeFile creates a file with content in dir that was last modified age ago.
+func writeFile(t *testing.T, dir, name, content string, age time.Duration) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte("new backup"))
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		check   Check
+		problem string
+	}{
+		{"newest", Check{Path: "backup-*.tar", MaxAge: 2 * time.Hour}, ""},
+		{"no match", Check{Path: "missing-*.tar"}, "no file matches"},
+		{"too old", Check{Path: "backup-*.tar", MaxAge: time.Minute}, "modified 1h0m0s ago"},
+		{"large enough", Check{Path: "backup-*.tar", MinSize: 10}, ""},
+		{"too small", Check{Path: "backup-*.tar", MinSize: 11}, "has 10 bytes, less than 11"},
+		{"checksum", Check{Path: "backup-*.tar", SHA256: strings.ToUpper(checksum)}, ""},
+		{"wrong checksum", Check{Path: "backup-*.tar", SHA256: strings.Repeat("0", 64)}, "does not match"},
+		{"checksum file", Check{Path: "backup-*.tar", ChecksumSuffix: ".sha256"}, ""},
+		{"missing checksum file", Check{Path: "backup-*.tar", ChecksumSuffix: ".md5"}, "checksum file"},
+		{"wrong checksum file", Check{Path: "old-*.tar", ChecksumSuffix: ".sha256"}, "does not match"},
+		{"regex", Check{Path: "backup-*.tar", Regex: "^new"}, ""},
+		{"regex mismatch", Check{Path: "backup-*.tar", Regex: "^old"}, "content does not match ^old"},
+		{"regex and checksum", Check{Path: "backup-*.tar", Regex: "new", SHA256: checksum}, ""},
+	}
+
+	dir := t.TempDir()
+	writeFile(t, dir, "backup-1.tar", "old backup, larger", 3*time.Hour)
+	writeFile(t, dir, "backup-2.tar", "new backup", time.Hour)
+	writeFile(t, dir, "backup-2.tar.sha256", checksum+"  backup-2.tar\n", time.Hour)
+	writeFile(t, dir, "old-1.tar", "old", time.Hour)
+	writeFile(t, dir, "old-1.tar.sha256", checksum+"  old-1.tar\n", time.Hour)
+
+	if err := os.Mkdir(filepath.Join(dir, "backup-3.tar"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			check := test.check
+			check.Path = filepath.Join(dir, check.Path)
+
+			if err := check.Setup(); err != nil {
+				t.Fatalf("Setup() = %v", err)
+			}
+
+			rep := &report.Report{}
+			err := check.Check(context.Background(), logr.Discard(), rep)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("Check() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("Check() = %v, want %q", err, test.problem)
+			}
+
+			if test.problem == "" {
+				want := "newest " + filepath.Join(dir, "backup-2.tar")
+				if notes := rep.Notes(); len(notes) != 1 || notes[0] != want {
+					t.Errorf("notes = %q, want [%q]", notes, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewestSkipsRemoved(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "backup-1.tar", "backup", time.Hour)
+
+	// A dangling symlink matches the glob but cannot be stated, like a file removed after globbing.
+	if err := os.Symlink(filepath.Join(dir, "removed.tar"), filepath.Join(dir, "backup-2.tar")); err != nil {
+		t.Fatal(err)
+	}
+
+	path, _, err := Check{Path: filepath.Join(dir, "backup-*.tar")}.newest()
+	if err != nil {
+		t.Fatalf("newest() = %v", err)
+	}
+
+	if want := filepath.Join(dir, "backup-1.tar"); path != want {
+		t.Errorf("newest() = %s, want %s", path, want)
+	}
+}
+
+func TestVerifyContentCanceled(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "backup.tar", "backup", time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	check := Check{Path: filepath.Join(dir, "backup.tar"), Regex: "backup"}
+	if err := check.Setup(); err != nil {
+		t.Fatalf("Setup() = %v", err)
+	}
+
+	if err := check.verifyContent(ctx, check.Path); !errors.Is(err, context.Canceled) {
+		t.Errorf("verifyContent() = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package host contains a health check for the host healthcheck runs on.
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// Threshold is a warning and a critical limit for a value. Exceeding the warning limit is reported, exceeding the
+// critical limit fails the check. Zero limits are not checked.
+type Threshold struct {
+	Warn     float64 `yaml:"warn"`
+	Critical float64 `yaml:"critical"`
+}
+
+// Filesystem contains thresholds for the ratio of used space and inodes of the filesystem mounted at Path.
+type Filesystem struct {
+	Path   string    `yaml:"path"`
+	Used   Threshold `yaml:"used"`
+	Inodes Threshold `yaml:"inodes"`
+}
+
+// Pressure contains thresholds for the share of time in percent some tasks stalled on a resource, averaged over
+// one minute.
+type Pressure struct {
+	CPU    Threshold `yaml:"cpu"`
+	Memory Threshold `yaml:"memory"`
+	IO     Threshold `yaml:"io"`
+}
+
+// Check for the health of the host itself. Memory and swap thresholds are ratios of used memory, the load threshold
+// applies to the five minute load average divided by the number of CPUs. Only values with configured thresholds are
+// read. If ClockSync is set, the system clock needs to be synchronized.
+type Check struct {
+	Filesystems []Filesystem `yaml:"filesystems"`
+	Memory      Threshold    `yaml:"memory"`
+	Swap        Threshold    `yaml:"swap"`
+	Pressure    Pressure     `yaml:"pressure"`
+	Load        Threshold    `yaml:"load"`
+	ClockSync   bool         `yaml:"clockSync"`
+}
+
+// set returns if any limit of t is configured.
+func (t Threshold) set() bool {
+	return t.Warn != 0 || t.Critical != 0
+}
+
+// verify records value as metric and compares it against the limits. It returns a problem if the critical limit is
+// exceeded.
+func (t Threshold) verify(name string, value float64, rep *report.Report) string {
+	rep.Metric(name, value, "")
+
+	switch {
+	case t.Critical != 0 && value > t.Critical:
+		return fmt.Sprintf("%s %.3g above %.3g", name, value, t.Critical)
+	case t.Warn != 0 && value > t.Warn:
+		rep.Warn("%s %.3g above %.3g", name, value, t.Warn)
+	}
+
+	return ""
+}
+
+// checkMemory verifies memory and swap usage if their thresholds are configured.
+func (c Check) checkMemory(rep *report.Report) ([]string, error) {
+	if !c.Memory.set() && !c.Swap.set() {
+		return nil, nil
+	}
+
+	info, err := readMeminfo()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+
+	if c.Memory.set() && info["MemTotal"] != 0 {
+		used := 1 - float64(info["MemAvailable"])/float64(info["MemTotal"])
+		problems = append(problems, c.Memory.verify("memory_used", used, rep))
+	}
+
+	if c.Swap.set() && info["SwapTotal"] != 0 {
+		used := 1 - float64(info["SwapFree"])/float64(info["SwapTotal"])
+		problems = append(problems, c.Swap.verify("swap_used", used, rep))
+	}
+
+	return problems, nil
+}
+
+// checkPressure verifies the stall information of all resources with configured thresholds. Kernels without
+// pressure stall information only cause a warning.
+func (c Check) checkPressure(rep *report.Report) ([]string, error) {
+	resources := []struct {
+		name      string
+		threshold Threshold
+	}{
+		{"cpu", c.Pressure.CPU},
+		{"memory", c.Pressure.Memory},
+		{"io", c.Pressure.IO},
+	}
+
+	problems := []string{}
+
+	for _, resource := range resources {
+		if !resource.threshold.set() {
+			continue
+		}
+
+		stalled, err := readPressure(resource.name)
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			rep.Warn("pressure stall information unsupported")
+
+			return problems, nil
+		case err != nil:
+			return nil, err
+		}
+
+		problems = append(problems, resource.threshold.verify("pressure_"+resource.name, stalled, rep))
+	}
+
+	return problems, nil
+}
+
+// checkLoad verifies the five minute load average per CPU if its threshold is configured.
+func (c Check) checkLoad(rep *report.Report) ([]string, error) {
+	if !c.Load.set() {
+		return nil, nil
+	}
+
+	load, err := readLoad()
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{c.Load.verify("load_per_cpu", load/float64(runtime.NumCPU()), rep)}, nil
+}
+
+// Check verifies the filesystems, memory, pressure, load and clock of the host.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	problems := []string{}
+
+	for _, filesystem := range c.Filesystems {
+		filesystemProblems, err := filesystem.verify(rep.Sub(filesystem.Path))
+		if err != nil {
+			return fmt.Errorf("host: filesystem %s: %w", filesystem.Path, err)
+		}
+
+		problems = append(problems, filesystemProblems...)
+	}
+
+	for _, check := range []func(*report.Report) ([]string, error){c.checkMemory, c.checkPressure, c.checkLoad} {
+		checkProblems, err := check(rep)
+		if err != nil {
+			return fmt.Errorf("host: %w", err)
+		}
+
+		problems = append(problems, checkProblems...)
+	}
+
+	if c.ClockSync {
+		synchronized, err := clockSynchronized(ctx)
+
+		switch {
+		case err != nil:
+			return fmt.Errorf("host: clock: %w", err)
+		case !synchronized:
+			problems = append(problems, "clock not synchronized")
+		}
+	}
+
+	failed := []string{}
+
+	for _, problem := range problems {
+		if problem != "" {
+			failed = append(failed, problem)
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("host: %s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+// readMeminfo returns the values of /proc/meminfo in kB.
+func readMeminfo() (map[string]uint64, error) {
+	content, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("meminfo: %w", err)
+	}
+
+	info := map[string]uint64{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		name, rest, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("meminfo: %s: %w", name, err)
+		}
+
+		info[name] = value
+	}
+
+	return info, nil
+}
+
+// readPressure returns the share of time in percent some tasks stalled on the given resource during the last minute.
+func readPressure(resource string) (float64, error) {
+	content, err := os.ReadFile("/proc/pressure/" + resource)
+	if err != nil {
+		return 0, fmt.Errorf("pressure: %w", err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg60=") {
+				stalled, err := strconv.ParseFloat(strings.TrimPrefix(field, "avg60="), 64)
+				if err != nil {
+					return 0, fmt.Errorf("pressure %s: %w", resource, err)
+				}
+
+				return stalled, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("pressure %s: no average found", resource)
+}
+
+// readLoad returns the five minute load average.
+func readLoad() (float64, error) {
+	content, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, fmt.Errorf("load: %w", err)
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("load: malformed")
+	}
+
+	load, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("load: %w", err)
+	}
+
+	return load, nil
+}
+
+// verify records the usage of the filesystem and compares it against the thresholds. The used ratio is calculated
+// like df does, from the space available to unprivileged users.
+func (f Filesystem) verify(rep *report.Report) ([]string, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(f.Path, &stat); err != nil {
+		return nil, fmt.Errorf("statfs: %w", err)
+	}
+
+	problems := []string{}
+
+	if used := stat.Blocks - stat.Bfree; used+stat.Bavail != 0 {
+		ratio := float64(used) / float64(used+stat.Bavail)
+		problems = append(problems, f.Used.verify("used", ratio, rep))
+	}
+
+	if stat.Files != 0 {
+		ratio := float64(stat.Files-stat.Ffree) / float64(stat.Files)
+		problems = append(problems, f.Inodes.verify("inodes_used", ratio, rep))
+	}
+
+	for i := range problems {
+		if problems[i] != "" {
+			problems[i] = f.Path + ": " + problems[i]
+		}
+	}
+
+	return problems, nil
+}
+
+// clockSynchronized asks systemd-timedated if the system clock is synchronized. Reading the kernel state directly
+// would require the adjtimex system call, which is denied by ProtectClock.
+func clockSynchronized(ctx context.Context) (bool, error) {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("connect to system bus: %w", err)
+	}
+
+	defer conn.Close()
+
+	var value dbus.Variant
+
+	object := conn.Object("org.freedesktop.timedate1", "/org/freedesktop/timedate1")
+
+	err = object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0,
+		"org.freedesktop.timedate1", "NTPSynchronized").Store(&value)
+	if err != nil {
+		return false, fmt.Errorf("get NTPSynchronized: %w", err)
+	}
+
+	synchronized, ok := value.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("NTPSynchronized has type %T", value.Value())
+	}
+
+	return synchronized, nil
+}
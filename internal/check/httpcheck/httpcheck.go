@@ -0,0 +1,195 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package httpcheck contains health checks for generic HTTP(S) endpoints.
+package httpcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"eqrx.net/service"
+	"github.com/go-logr/logr"
+)
+
+// JSONAssertion expects a value at a path within a JSON response body. Paths are written like `$.a.b[0]`.
+// If Value is empty, the path only needs to exist.
+type JSONAssertion struct {
+	Path  string `yaml:"path"`
+	Value string `yaml:"value"`
+}
+
+// Check sends a request to every address of an HTTP(S) endpoint and verifies the responses. AddressFamilies selects
+// v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool                `yaml:"ipv4"`
+	AddressFamilies    string              `yaml:"addressFamilies"`
+	RequireAllFamilies bool                `yaml:"requireAllFamilies"`
+	URL                string              `yaml:"url"`
+	Method             string              `yaml:"method"`
+	Headers            map[string]string   `yaml:"headers"`
+	Body               string              `yaml:"body"`
+	Status             []int               `yaml:"status"`
+	BodyContains       string              `yaml:"bodyContains"`
+	BodyRegex          string              `yaml:"bodyRegex"`
+	JSON               []JSONAssertion     `yaml:"json"`
+	MaxRedirects       int                 `yaml:"maxRedirects"`
+	ClientCertName     string              `yaml:"clientCertName"`
+	Certificates       tlscheck.Inspection `yaml:"certificates"`
+	url                *url.URL            `yaml:"-"`
+	bodyRegex          *regexp.Regexp      `yaml:"-"`
+	clientCert         []tls.Certificate   `yaml:"-"`
+	families           []netcheck.Family   `yaml:"-"`
+	targetRRType       uint16              `yaml:"-"`
+	network            string              `yaml:"-"`
+}
+
+// Setup parses the configuration and loads the client certificate if configured. The client certificate
+// credentials need to contain both the PEM encoded certificate and key. If the URL host is an IP literal, only its
+// address family is probed.
+func (c *Check) Setup() error {
+	parsed, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("url: unsupported scheme %q", parsed.Scheme)
+	}
+
+	c.url = parsed
+
+	if addr, err := netip.ParseAddr(parsed.Hostname()); err == nil {
+		c.IPV4, c.AddressFamilies = addr.Unmap().Is4(), ""
+	}
+
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Method == "" {
+		c.Method = http.MethodGet
+	}
+
+	if c.BodyRegex != "" {
+		if c.bodyRegex, err = regexp.Compile(c.BodyRegex); err != nil {
+			return fmt.Errorf("body regex: %w", err)
+		}
+	}
+
+	for _, assertion := range c.JSON {
+		if _, err := parsePath(assertion.Path); err != nil {
+			return fmt.Errorf("json path %s: %w", assertion.Path, err)
+		}
+	}
+
+	if c.ClientCertName != "" {
+		credDir, err := service.CredsDir()
+		if err != nil {
+			return fmt.Errorf("client certificate: %w", err)
+		}
+
+		certPEM, err := os.ReadFile(path.Join(credDir, c.ClientCertName))
+		if err != nil {
+			return fmt.Errorf("client certificate: %w", err)
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, certPEM)
+		if err != nil {
+			return fmt.Errorf("client certificate: %w", err)
+		}
+
+		c.clientCert = []tls.Certificate{cert}
+	}
+
+	return nil
+}
+
+// port returns the port of the URL, derived from the scheme if not given explicitly.
+func (c Check) port() string {
+	if port := c.url.Port(); port != "" {
+		return port
+	}
+
+	if c.url.Scheme == "http" {
+		return "80"
+	}
+
+	return "443"
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// Check resolves the host of the URL for each address family and sends the request to each of its addresses.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
+		})
+	if err != nil {
+		return fmt.Errorf("http check: %w", err)
+	}
+
+	return nil
+}
+
+// checkServers resolves the host of the URL and sends the request to each of its addresses.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	addrs, err := netcheck.Resolve(ctx, c.url.Hostname(), c.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", c.url.Hostname(), err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", c.url.Hostname(), netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		addrPort := net.JoinHostPort(addrs[i].String(), c.port())
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.request(ctx, addrPort, rep.Sub(addrPort)); err != nil {
+				return fmt.Errorf("%s: %w", addrPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
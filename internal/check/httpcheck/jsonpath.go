@@ -0,0 +1,128 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package httpcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parsePath splits a path like `$.a.b[0]` into its steps. Steps are either object keys or array indices.
+func parsePath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+
+	steps := []interface{}{}
+	rest := path[1:]
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key")
+			}
+
+			steps = append(steps, key)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index")
+			}
+
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("index: %w", err)
+			}
+
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+
+	return steps, nil
+}
+
+// lookup returns the value at path within document.
+func lookup(document interface{}, path string) (interface{}, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := document
+
+	for _, step := range steps {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("not an object at %s", step)
+			}
+
+			if value, ok = object[step]; !ok {
+				return nil, fmt.Errorf("key %s not found", step)
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok || step < 0 || step >= len(array) {
+				return nil, fmt.Errorf("index %d not found", step)
+			}
+
+			value = array[step]
+		}
+	}
+
+	return value, nil
+}
+
+// assert checks a JSON assertion against document. Strings are compared as they are, other values in their JSON
+// encoding.
+func assert(document interface{}, assertion JSONAssertion) error {
+	value, err := lookup(document, assertion.Path)
+	if err != nil {
+		return err
+	}
+
+	if assertion.Value == "" {
+		return nil
+	}
+
+	actual, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+
+		actual = string(encoded)
+	}
+
+	if actual != assertion.Value {
+		return fmt.Errorf("expected %q, got %q", assertion.Value, actual)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package httpcheck
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path    string
+		steps   []interface{}
+		problem string
+	}{
+		{"$", []interface{}{}, ""},
+		{"$.status", []interface{}{"status"}, ""},
+		{"$.a.b[0]", []interface{}{"a", "b", 0}, ""},
+		{"$[2].name", []interface{}{2, "name"}, ""},
+		{"$.list[1][3]", []interface{}{"list", 1, 3}, ""},
+		{"status", nil, "path must start with $"},
+		{"$..a", nil, "empty key"},
+		{"$.a.", nil, "empty key"},
+		{"$.a[1", nil, "unterminated index"},
+		{"$.a[x]", nil, "index"},
+		{"$a", nil, "unexpected 'a'"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.path, func(t *testing.T) {
+			t.Parallel()
+
+			steps, err := parsePath(test.path)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("parsePath() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("parsePath() = %v, want %q", err, test.problem)
+			case test.problem == "" && !reflect.DeepEqual(steps, test.steps):
+				t.Errorf("parsePath() = %#v, want %#v", steps, test.steps)
+			}
+		})
+	}
+}
+
+func TestAssert(t *testing.T) {
+	t.Parallel()
+
+	var document interface{}
+
+	raw := `{"status": "ok", "version": 3, "healthy": true, "checks": [{"name": "db", "up": false}], "none": null}`
+	if err := json.Unmarshal([]byte(raw), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		assertion JSONAssertion
+		problem   string
+	}{
+		{"string", JSONAssertion{Path: "$.status", Value: "ok"}, ""},
+		{"number", JSONAssertion{Path: "$.version", Value: "3"}, ""},
+		{"bool", JSONAssertion{Path: "$.healthy", Value: "true"}, ""},
+		{"null", JSONAssertion{Path: "$.none", Value: "null"}, ""},
+		{"object", JSONAssertion{Path: "$.checks[0]", Value: `{"name":"db","up":false}`}, ""},
+		{"nested", JSONAssertion{Path: "$.checks[0].up", Value: "false"}, ""},
+		{"exists", JSONAssertion{Path: "$.checks[0].name"}, ""},
+		{"mismatch", JSONAssertion{Path: "$.status", Value: "degraded"}, `expected "degraded", got "ok"`},
+		{"quoted number", JSONAssertion{Path: "$.version", Value: `"3"`}, `got "3"`},
+		{"missing key", JSONAssertion{Path: "$.uptime"}, "key uptime not found"},
+		{"index out of range", JSONAssertion{Path: "$.checks[1]"}, "index 1 not found"},
+		{"index on object", JSONAssertion{Path: "$[0]"}, "index 0 not found"},
+		{"key on array", JSONAssertion{Path: "$.checks.name"}, "not an object at name"},
+		{"invalid path", JSONAssertion{Path: "status"}, "path must start with $"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := assert(document, test.assertion)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("assert() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("assert() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package httpcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// bodyLimit is the maximum number of bytes read from a response body. Longer bodies fail body assertions.
+const bodyLimit = 1 << 20
+
+// httpClient returns a client that connects to toAddr whenever the URL host is requested. Connections to other hosts,
+// for example after redirects, are resolved normally.
+func (c Check) httpClient(toAddr string) *http.Client {
+	fromAddr := net.JoinHostPort(c.url.Hostname(), c.port())
+
+	transport := &http.Transport{
+		IdleConnTimeout: 1 * time.Second,
+		TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, Certificates: c.clientCert},
+		DialContext: func(ctx context.Context, _, actual string) (net.Conn, error) {
+			if actual == fromAddr {
+				actual = toAddr
+			}
+
+			return (&net.Dialer{}).DialContext(ctx, c.network, actual)
+		},
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) > c.MaxRedirects {
+				return http.ErrUseLastResponse
+			}
+
+			return nil
+		},
+	}
+}
+
+// statusOK checks if the status code is one of the expected ones, or 2xx if none are configured.
+func (c Check) statusOK(status int) bool {
+	if len(c.Status) == 0 {
+		return status >= 200 && status < 300
+	}
+
+	for _, expected := range c.Status {
+		if status == expected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyBody checks the response body against all configured assertions. Truncated bodies are rejected if there
+// is anything to check since assertions on a part of the body are meaningless.
+func (c Check) verifyBody(body []byte, truncated bool) error {
+	if truncated && (c.BodyContains != "" || c.bodyRegex != nil || len(c.JSON) != 0) {
+		return fmt.Errorf("body truncated, longer than %d bytes", bodyLimit)
+	}
+
+	if c.BodyContains != "" && !bytes.Contains(body, []byte(c.BodyContains)) {
+		return fmt.Errorf("body does not contain %q", c.BodyContains)
+	}
+
+	if c.bodyRegex != nil && !c.bodyRegex.Match(body) {
+		return fmt.Errorf("body does not match %q", c.BodyRegex)
+	}
+
+	if len(c.JSON) == 0 {
+		return nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+
+	for _, assertion := range c.JSON {
+		if err := assert(document, assertion); err != nil {
+			return fmt.Errorf("json %s: %w", assertion.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// request sends the configured request to addr and verifies the response. The time until the response was read is
+// reported as metric.
+func (c Check) request(ctx context.Context, addr string, rep *report.Report) error {
+	request, err := http.NewRequestWithContext(ctx, c.Method, c.url.String(), strings.NewReader(c.Body))
+	if err != nil {
+		return fmt.Errorf("create http request: %w", err)
+	}
+
+	for key, value := range c.Headers {
+		request.Header.Set(key, value)
+	}
+
+	if host, ok := c.Headers["Host"]; ok {
+		request.Host = host
+	}
+
+	start := time.Now()
+
+	response, err := c.httpClient(addr).Do(request)
+	if err != nil {
+		return fmt.Errorf("execute http request: %w", err)
+	}
+
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, bodyLimit+1))
+	truncated := len(body) > bodyLimit
+
+	if truncated {
+		body = body[:bodyLimit]
+	}
+
+	closeErr := response.Body.Close()
+
+	rep.Metric("response_time", time.Since(start).Seconds(), "s")
+
+	if response.TLS != nil {
+		c.Certificates.Inspect(*response.TLS, rep)
+	}
+
+	switch {
+	case readErr != nil:
+		return fmt.Errorf("read body: %w", readErr)
+	case closeErr != nil:
+		return fmt.Errorf("close body: %w", closeErr)
+	case !c.statusOK(response.StatusCode):
+		return fmt.Errorf("unexpected http response status: %v", response.StatusCode)
+	default:
+		return c.verifyBody(body, truncated)
+	}
+}
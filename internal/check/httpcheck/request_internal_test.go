@@ -0,0 +1,58 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package httpcheck
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		check     Check
+		body      string
+		truncated bool
+		problem   string
+	}{
+		{"no assertions", Check{}, "anything", false, ""},
+		{"truncated without assertions", Check{}, "anything", true, ""},
+		{"contains", Check{BodyContains: "ok"}, "all ok", false, ""},
+		{"not contained", Check{BodyContains: "ok"}, "down", false, `body does not contain "ok"`},
+		{"truncated", Check{BodyContains: "ok"}, "all ok", true, "body truncated"},
+		{"json", Check{JSON: []JSONAssertion{{Path: "$.status", Value: "ok"}}}, `{"status": "ok"}`, false, ""},
+		{"json mismatch", Check{JSON: []JSONAssertion{{Path: "$.status", Value: "ok"}}}, `{"status": "down"}`, false,
+			`json $.status: expected "ok", got "down"`},
+		{"invalid json", Check{JSON: []JSONAssertion{{Path: "$"}}}, `{"status"`, false, "body:"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.check.verifyBody([]byte(test.body), test.truncated)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("verifyBody() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("verifyBody() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
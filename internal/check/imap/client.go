@@ -0,0 +1,226 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// literal matches the announcement of a literal at the end of an IMAP response line.
+var literal = regexp.MustCompile(`\{(\d+)\}\r\n$`)
+
+// Client is a minimal IMAP4rev1 client that only knows what health checks need.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// NewClient reads the server greeting from conn and returns a client using it.
+func NewClient(conn net.Conn) (*Client, error) {
+	client := &Client{conn: conn, reader: bufio.NewReader(conn)}
+
+	greeting, err := client.readLine()
+	if err != nil {
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		return nil, fmt.Errorf("protocol failure: unexpected greeting: %s", greeting)
+	}
+
+	return client, nil
+}
+
+// Quote formats s as IMAP quoted string.
+func Quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// readLine reads a response line including all literals it contains. Line endings are stripped.
+func (c *Client) readLine() (string, error) {
+	line := ""
+
+	for {
+		part, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		line += part
+
+		match := literal.FindStringSubmatch(part)
+		if match == nil {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+
+		size, err := strconv.Atoi(match[1])
+		if err != nil {
+			return "", fmt.Errorf("literal size: %w", err)
+		}
+
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.reader, literal); err != nil {
+			return "", fmt.Errorf("read literal: %w", err)
+		}
+
+		line += string(literal)
+	}
+}
+
+// Command sends a tagged command and returns the untagged responses the server sent before completing it.
+// An error is returned if the completion is not OK.
+func (c *Client) Command(format string, args ...interface{}) ([]string, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+
+	if _, err := fmt.Fprintf(c.conn, tag+" "+format+"\r\n", args...); err != nil {
+		return nil, fmt.Errorf("write command: %w", err)
+	}
+
+	untagged := []string{}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+
+		if !strings.HasPrefix(line, tag+" ") {
+			untagged = append(untagged, line)
+
+			continue
+		}
+
+		if status := strings.TrimPrefix(line, tag+" "); !strings.HasPrefix(status, "OK") {
+			return nil, fmt.Errorf("server responded: %s", status)
+		}
+
+		return untagged, nil
+	}
+}
+
+// Capabilities returns the capabilities the server currently announces.
+func (c *Client) Capabilities() ([]string, error) {
+	lines, err := c.Command("CAPABILITY")
+	if err != nil {
+		return nil, fmt.Errorf("CAPABILITY: %w", err)
+	}
+
+	capabilities := []string{}
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, "* CAPABILITY ") {
+			capabilities = append(capabilities, strings.Fields(strings.TrimPrefix(line, "* CAPABILITY "))...)
+		}
+	}
+
+	return capabilities, nil
+}
+
+// StartTLS asks the server to start TLS and upgrades the connection with the given handshake.
+func (c *Client) StartTLS(handshake func(net.Conn) (*tls.Conn, error)) error {
+	if _, err := c.Command("STARTTLS"); err != nil {
+		return fmt.Errorf("STARTTLS: %w", err)
+	}
+
+	tlsConn, err := handshake(c.conn)
+	if err != nil {
+		return err
+	}
+
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+
+	return nil
+}
+
+// TLSConnectionState returns the state of the TLS connection, if there is one.
+func (c *Client) TLSConnectionState() (tls.ConnectionState, bool) {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+
+	return tlsConn.ConnectionState(), true
+}
+
+// Login authenticates with username and password.
+func (c *Client) Login(username, password string) error {
+	if _, err := c.Command("LOGIN %s %s", Quote(username), Quote(password)); err != nil {
+		return fmt.Errorf("LOGIN: %w", err)
+	}
+
+	return nil
+}
+
+// Select opens the given mailbox.
+func (c *Client) Select(mailbox string) error {
+	if _, err := c.Command("SELECT %s", Quote(mailbox)); err != nil {
+		return fmt.Errorf("SELECT: %w", err)
+	}
+
+	return nil
+}
+
+// Search returns the UIDs of all messages in the selected mailbox with a header field containing value.
+func (c *Client) Search(field, value string) ([]string, error) {
+	if _, err := c.Command("NOOP"); err != nil {
+		return nil, fmt.Errorf("NOOP: %w", err)
+	}
+
+	lines, err := c.Command("UID SEARCH HEADER %s %s", Quote(field), Quote(value))
+	if err != nil {
+		return nil, fmt.Errorf("SEARCH: %w", err)
+	}
+
+	uids := []string{}
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(line, "* SEARCH"))...)
+		}
+	}
+
+	return uids, nil
+}
+
+// Delete removes the messages with the given UIDs from the selected mailbox.
+func (c *Client) Delete(uids []string) error {
+	if _, err := c.Command(`UID STORE %s +FLAGS.SILENT (\Deleted)`, strings.Join(uids, ",")); err != nil {
+		return fmt.Errorf("STORE: %w", err)
+	}
+
+	if _, err := c.Command("EXPUNGE"); err != nil {
+		return fmt.Errorf("EXPUNGE: %w", err)
+	}
+
+	return nil
+}
+
+// Logout ends the session.
+func (c *Client) Logout() error {
+	if _, err := c.Command("LOGOUT"); err != nil {
+		return fmt.Errorf("LOGOUT: %w", err)
+	}
+
+	return nil
+}
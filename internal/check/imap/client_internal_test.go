@@ -0,0 +1,154 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exchange is a command the stand-in server expects and its reply.
+type exchange struct {
+	command string
+	reply   string
+}
+
+// pipe returns a client connection to a stand-in server that sends greeting and then answers the expected
+// commands in order. It stops at the first unexpected command. The test waits for the server to stop.
+func pipe(t *testing.T, greeting string, exchanges ...exchange) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		defer server.Close()
+
+		if _, err := io.WriteString(server, greeting); err != nil {
+			return
+		}
+
+		reader := bufio.NewReader(server)
+
+		for _, exchange := range exchanges {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			if line != exchange.command+"\r\n" {
+				t.Errorf("command = %q, want %q", line, exchange.command)
+
+				return
+			}
+
+			if _, err := io.WriteString(server, exchange.reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	return client
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(pipe(t, "* OK IMAP4rev1 ready\r\n",
+		exchange{"a1 CAPABILITY", "* CAPABILITY IMAP4rev1 STARTTLS AUTH=PLAIN\r\na1 OK done\r\n"},
+		exchange{`a2 LOGIN "user" "pa\"ss"`, "a2 OK logged in\r\n"},
+		exchange{`a3 SELECT "INBOX"`, "* 2 EXISTS\r\na3 OK [READ-WRITE] selected\r\n"},
+		exchange{"a4 NOOP", "a4 OK done\r\n"},
+		exchange{`a5 UID SEARCH HEADER "Subject" "probe"`, "* SEARCH 4 7\r\na5 OK done\r\n"},
+		exchange{`a6 UID STORE 4,7 +FLAGS.SILENT (\Deleted)`, "a6 OK done\r\n"},
+		exchange{"a7 EXPUNGE", "* 1 EXPUNGE\r\n* 1 EXPUNGE\r\na7 OK done\r\n"},
+		exchange{"a8 LOGOUT", "* BYE logging out\r\na8 OK done\r\n"},
+	))
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	capabilities, err := client.Capabilities()
+	if want := []string{"IMAP4rev1", "STARTTLS", "AUTH=PLAIN"}; err != nil || !reflect.DeepEqual(capabilities, want) {
+		t.Fatalf("Capabilities() = %q, %v, want %q", capabilities, err, want)
+	}
+
+	if err := client.Login("user", `pa"ss`); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	if err := client.Select("INBOX"); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	uids, err := client.Search("Subject", "probe")
+	if want := []string{"4", "7"}; err != nil || !reflect.DeepEqual(uids, want) {
+		t.Fatalf("Search() = %q, %v, want %q", uids, err, want)
+	}
+
+	if err := client.Delete(uids); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+
+	if err := client.Logout(); err != nil {
+		t.Fatalf("Logout() = %v", err)
+	}
+}
+
+func TestClientLiteral(t *testing.T) {
+	t.Parallel()
+
+	client, err := NewClient(pipe(t, "* PREAUTH ready\r\n",
+		exchange{"a1 FETCH 1 (BODY[HEADER])", "* 1 FETCH (BODY[HEADER] {12}\r\nSubject: x\r\n)\r\na1 OK done\r\n"},
+	))
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	lines, err := client.Command("FETCH 1 (BODY[HEADER])")
+	if want := []string{"* 1 FETCH (BODY[HEADER] {12}\r\nSubject: x\r\n)"}; err != nil || !reflect.DeepEqual(lines, want) {
+		t.Errorf("Command() = %q, %v, want %q", lines, err, want)
+	}
+}
+
+func TestClientFailures(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewClient(pipe(t, "* BYE too busy\r\n")); err == nil ||
+		!strings.Contains(err.Error(), "unexpected greeting: * BYE too busy") {
+		t.Errorf("NewClient() = %v", err)
+	}
+
+	client, err := NewClient(pipe(t, "* OK ready\r\n",
+		exchange{`a1 LOGIN "user" "wrong"`, "a1 NO [AUTHENTICATIONFAILED] invalid credentials\r\n"},
+	))
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+
+	if err := client.Login("user", "wrong"); err == nil ||
+		!strings.Contains(err.Error(), "LOGIN: server responded: NO [AUTHENTICATIONFAILED]") {
+		t.Errorf("Login() = %v", err)
+	}
+}
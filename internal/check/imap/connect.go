@@ -0,0 +1,62 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// session runs the IMAP dialogue on conn.
+func (c Check) session(conn net.Conn, rep *report.Report) error {
+	client, err := NewClient(conn)
+	if err != nil {
+		return err
+	}
+
+	if c.Service.Mode == tlscheck.ModeSTARTTLS {
+		if err := client.StartTLS(c.Service.StartTLS); err != nil {
+			return err
+		}
+	}
+
+	capabilities, err := client.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	if state, ok := client.TLSConnectionState(); ok {
+		c.Service.Certificates.Inspect(state, rep)
+	}
+
+	if missing := tlscheck.MissingCapabilities(capabilities, c.Capabilities); len(missing) != 0 {
+		return fmt.Errorf("capabilities missing: %s", strings.Join(missing, ", "))
+	}
+
+	if creds := c.Service.Creds(); creds != nil {
+		if err := client.Login(creds.Username, creds.Password); err != nil {
+			return err
+		}
+
+		if err := client.Select(c.Mailbox); err != nil {
+			return err
+		}
+	}
+
+	return client.Logout()
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package imap contains health checks for IMAP servers.
+package imap
+
+import (
+	"context"
+	"fmt"
+
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// Check resolves an IMAP server, tests its TLS function and capabilities and optionally logs in and opens the
+// mailbox.
+type Check struct {
+	Service      tlscheck.Service `yaml:",inline"`
+	Capabilities []string         `yaml:"capabilities"`
+	Mailbox      string           `yaml:"mailbox"`
+}
+
+// Setup prepares often used values and loads the credentials if configured.
+func (c *Check) Setup() error {
+	if err := c.Service.Setup("993", "143"); err != nil {
+		return err
+	}
+
+	if c.Mailbox == "" {
+		c.Mailbox = "INBOX"
+	}
+
+	return nil
+}
+
+// Check resolves the host and connects to all its addresses.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if err := c.Service.Run(ctx, rep, c.session); err != nil {
+		return fmt.Errorf("imap check: %w", err)
+	}
+
+	return nil
+}
@@ -15,16 +15,24 @@ package matrix
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/netip"
 	"net/url"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
 )
 
-func (c Check) connect(ctx context.Context, url url.URL, addr netip.AddrPort) error {
-	httpClient := c.httpClient(addr.String(), url.Host)
+// connect requests the client API versions from a single homeserver address, inspects its certificate and verifies
+// the announced versions.
+func (c Check) connect(ctx context.Context, base url.URL, addr netip.AddrPort, rep *report.Report) error {
+	httpClient := c.httpClient(addr.String(), hostPort(base))
+
+	base.Path = strings.TrimSuffix(base.Path, "/") + versionsPath
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodHead, url.String(), nil)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, base.String(), nil)
 	if err != nil {
 		panic(fmt.Sprintf("create http request: %v", err))
 	}
@@ -34,12 +42,27 @@ func (c Check) connect(ctx context.Context, url url.URL, addr netip.AddrPort) er
 		return fmt.Errorf("execute http request: %w", err)
 	}
 
+	var versions versionsResponse
+
+	readErr := json.NewDecoder(response.Body).Decode(&versions)
+
 	if err := response.Body.Close(); err != nil {
 		return fmt.Errorf("close http response body: %w", err)
 	}
 
-	if response.StatusCode != http.StatusNotFound {
-		return fmt.Errorf("matrix endpoint failed")
+	if response.TLS != nil {
+		c.Certificates.Inspect(*response.TLS, rep)
+	}
+
+	switch {
+	case response.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s: unexpected http response status: %v", versionsPath, response.StatusCode)
+	case readErr != nil:
+		return fmt.Errorf("%s: read body: %w", versionsPath, readErr)
+	}
+
+	if err := c.Versions.verify(versions, rep); err != nil {
+		return fmt.Errorf("%s: %w", versionsPath, err)
 	}
 
 	return nil
@@ -0,0 +1,271 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/miekg/dns"
+)
+
+const (
+	// federationPort is the port federation traffic is sent to if nothing else is advertised.
+	federationPort = 8448
+	// srvService is the SRV service name for federation.
+	srvService = "_matrix-fed._tcp."
+	// legacySRVService is the deprecated SRV service name for federation, used if srvService has no records.
+	legacySRVService = "_matrix._tcp."
+)
+
+// Discovery selects which discovery paths need to exist for the domain. Paths that are not required are still
+// followed if present.
+type Discovery struct {
+	ClientWellKnown bool `yaml:"clientWellKnown"`
+	ServerWellKnown bool `yaml:"serverWellKnown"`
+	SRV             bool `yaml:"srv"`
+}
+
+// hostPort returns host and port of u, the port defaulting to the one of the scheme.
+func hostPort(u url.URL) string {
+	port := u.Port()
+
+	switch {
+	case port != "":
+	case u.Scheme == "http":
+		port = "80"
+	default:
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// addrTargets resolves host and returns a target for each of its addresses. The URL uses certName as host since
+// that is what the presented certificate needs to be valid for. IP literals are used as they are.
+func (c Check) addrTargets(ctx context.Context, scheme, certName, host string, port uint16) ([]target, error) {
+	addrs, err := netcheck.Resolve(ctx, host, c.targetRRType)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", host, err)
+	}
+
+	url, err := url.Parse(scheme + "://" + net.JoinHostPort(certName, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	targets := []target{}
+	for _, addr := range addrs {
+		targets = append(targets, target{url: *url, addr: netip.AddrPortFrom(addr, port)})
+	}
+
+	return targets, nil
+}
+
+// resolveClientTargets determines the client API base URL from the client well-known of the domain and returns its
+// targets. Without well-known the domain itself is used.
+func (c Check) resolveClientTargets(ctx context.Context, rep *report.Report) ([]target, error) {
+	var wellKnown clientWellKnown
+
+	baseURL := "https://" + c.Domain
+
+	err := c.loadWellKnown(ctx, "client", &wellKnown)
+
+	switch {
+	case err == nil && wellKnown.Homeserver.URL == "":
+		return nil, fmt.Errorf("client well-known: no base URL")
+	case err == nil:
+		baseURL = wellKnown.Homeserver.URL
+	case c.Require.ClientWellKnown:
+		return nil, fmt.Errorf("client well-known: %w", err)
+	case !errors.Is(err, errNotFound):
+		rep.Warn("client well-known: %v", err)
+	}
+
+	url, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("base URL: %w", err)
+	}
+
+	if url.Scheme != "https" && url.Scheme != "http" {
+		return nil, fmt.Errorf("base URL: unsupported scheme %q", url.Scheme)
+	}
+
+	host, portPart, err := net.SplitHostPort(hostPort(*url))
+	if err != nil {
+		panic(fmt.Sprintf("split joined host and port: %v", err))
+	}
+
+	port, err := strconv.ParseUint(portPart, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("base URL: port: %w", err)
+	}
+
+	targets, err := c.addrTargets(ctx, url.Scheme, host, host, uint16(port))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range targets {
+		targets[i].url.Path = url.Path
+	}
+
+	return targets, nil
+}
+
+// lookupSRV returns the federation SRV records of name ordered by priority and weight. The deprecated service
+// name is only consulted if the current one has no records.
+func (c Check) lookupSRV(ctx context.Context, name string) ([]*dns.SRV, error) {
+	for _, service := range []string{srvService, legacySRVService} {
+		question := (&dns.Msg{}).SetQuestion(service+dns.Fqdn(name), dns.TypeSRV)
+
+		answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, netcheck.DNSServer)
+		if err != nil {
+			return nil, fmt.Errorf("dns exchange: %w", err)
+		}
+
+		records := []*dns.SRV{}
+
+		for i := range answer.Answer {
+			if record, ok := answer.Answer[i].(*dns.SRV); ok {
+				records = append(records, record)
+			}
+		}
+
+		if len(records) == 0 {
+			continue
+		}
+
+		if len(records) == 1 && records[0].Target == "." {
+			return nil, fmt.Errorf("%s%s: service explicitly not available", service, name)
+		}
+
+		sort.SliceStable(records, func(i, j int) bool {
+			if records[i].Priority != records[j].Priority {
+				return records[i].Priority < records[j].Priority
+			}
+
+			return records[i].Weight > records[j].Weight
+		})
+
+		return records, nil
+	}
+
+	return nil, nil
+}
+
+// explicitFederationTargets returns the targets for server names that are IP literals or have a port. ok is false
+// for server names that are subject to further discovery.
+func (c Check) explicitFederationTargets(ctx context.Context, name string) (targets []target, ok bool, err error) {
+	if addr, err := netip.ParseAddr(name); err == nil {
+		targets, err := c.addrTargets(ctx, "https", name, addr.String(), federationPort)
+
+		return targets, true, err
+	}
+
+	host, portPart, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	port, err := strconv.ParseUint(portPart, 10, 16)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: port: %w", name, err)
+	}
+
+	targets, err = c.addrTargets(ctx, "https", host, host, uint16(port))
+
+	return targets, true, err
+}
+
+// srvFederationTargets returns the targets of the SRV records of name or name on the federation port if there are
+// none. Targets of records that do not have the lowest priority are backups.
+func (c Check) srvFederationTargets(ctx context.Context, name string) ([]target, error) {
+	records, err := c.lookupSRV(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		if c.Require.SRV {
+			return nil, fmt.Errorf("no SRV records for %s", name)
+		}
+
+		return c.addrTargets(ctx, "https", name, name, federationPort)
+	}
+
+	targets := []target{}
+
+	for _, record := range records {
+		recordTargets, err := c.addrTargets(ctx, "https", name, record.Target, record.Port)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range recordTargets {
+			recordTargets[i].backup = record.Priority != records[0].Priority
+		}
+
+		targets = append(targets, recordTargets...)
+	}
+
+	return targets, nil
+}
+
+// resolveFederationTargets follows the server discovery of the matrix specification to determine where federation
+// traffic for the domain is sent to. Explicit addresses and ports take precedence, then the delegation in the server
+// well-known, then SRV records and lastly the server name itself on the federation port.
+func (c Check) resolveFederationTargets(ctx context.Context, rep *report.Report) ([]target, error) {
+	if targets, ok, err := c.explicitFederationTargets(ctx, c.Domain); ok {
+		if err == nil && (c.Require.ServerWellKnown || c.Require.SRV) {
+			return nil, fmt.Errorf("%s is explicit, no discovery is done", c.Domain)
+		}
+
+		return targets, err
+	}
+
+	var wellKnown serverWellKnown
+
+	err := c.loadWellKnown(ctx, "server", &wellKnown)
+
+	switch {
+	case err == nil && wellKnown.Server == "":
+		return nil, fmt.Errorf("server well-known: no server")
+	case err == nil:
+		targets, ok, err := c.explicitFederationTargets(ctx, wellKnown.Server)
+		if !ok {
+			return c.srvFederationTargets(ctx, wellKnown.Server)
+		}
+
+		if err == nil && c.Require.SRV {
+			return nil, fmt.Errorf("server well-known delegates to explicit %s, no SRV lookup is done", wellKnown.Server)
+		}
+
+		return targets, err
+	case c.Require.ServerWellKnown:
+		return nil, fmt.Errorf("server well-known: %w", err)
+	case !errors.Is(err, errNotFound):
+		rep.Warn("server well-known: %v", err)
+	}
+
+	return c.srvFederationTargets(ctx, c.Domain)
+}
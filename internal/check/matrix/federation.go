@@ -0,0 +1,237 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// defaultKeyExpiryWarning is how long before their expiry server keys are warned about if nothing else is
+	// configured.
+	defaultKeyExpiryWarning = time.Hour
+	// maxSafeInteger is the largest integer canonical JSON allows.
+	maxSafeInteger = 1<<53 - 1
+)
+
+type federationVersion struct {
+	Server struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"server"`
+}
+
+type serverKeys struct {
+	ServerName string `json:"server_name"`
+	ValidUntil int64  `json:"valid_until_ts"`
+	VerifyKeys map[string]struct {
+		Key string `json:"key"`
+	} `json:"verify_keys"`
+	Signatures map[string]map[string]string `json:"signatures"`
+}
+
+// canonicalJSON encodes raw as canonical JSON with the given top level keys removed. Go sorts map keys and
+// does not emit whitespace, escaping of HTML characters is disabled to match the matrix specification. Integral
+// numbers are written without fraction or exponent.
+func canonicalJSON(raw []byte, without ...string) ([]byte, error) {
+	var object map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	for _, key := range without {
+		delete(object, key)
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(canonicalNumbers(object)); err != nil {
+		return nil, fmt.Errorf("encode: %w", err)
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// canonicalNumbers replaces integral numbers in value with their plain integer form, like 10000000000 for 1e10 and
+// 0 for -0. Other numbers are kept as they are.
+func canonicalNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = canonicalNumbers(element)
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = canonicalNumbers(element)
+		}
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+
+		if float, err := value.Float64(); err == nil && float == math.Trunc(float) && math.Abs(float) <= maxSafeInteger {
+			return int64(float)
+		}
+	}
+
+	return value
+}
+
+// verifyServerKeys checks that the key response belongs to the domain, is not expired and is signed by at least
+// one of its verify keys. All signatures made by the server need to be valid.
+func (c Check) verifyServerKeys(raw []byte, rep *report.Report) error {
+	var keys serverKeys
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	if keys.ServerName != c.Domain {
+		return fmt.Errorf("keys belong to %s", keys.ServerName)
+	}
+
+	validUntil := time.UnixMilli(keys.ValidUntil)
+	remaining := time.Until(validUntil)
+
+	rep.Metric("key_validity", remaining.Hours(), "h")
+
+	if remaining <= 0 {
+		return fmt.Errorf("keys expired at %s", validUntil.Format(time.RFC3339))
+	}
+
+	if remaining < c.KeyExpiryWarning {
+		rep.Warn("keys expire at %s", validUntil.Format(time.RFC3339))
+	}
+
+	signed, err := canonicalJSON(raw, "signatures", "unsigned")
+	if err != nil {
+		return err
+	}
+
+	verified := false
+
+	for keyID, encodedSignature := range keys.Signatures[c.Domain] {
+		verifyKey, ok := keys.VerifyKeys[keyID]
+		if !ok {
+			continue
+		}
+
+		publicKey, err := base64.RawStdEncoding.DecodeString(verifyKey.Key)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("key %s: invalid public key", keyID)
+		}
+
+		signature, err := base64.RawStdEncoding.DecodeString(encodedSignature)
+		if err != nil {
+			return fmt.Errorf("key %s: invalid signature encoding", keyID)
+		}
+
+		if !ed25519.Verify(publicKey, signed, signature) {
+			return fmt.Errorf("key %s: invalid signature", keyID)
+		}
+
+		verified = true
+	}
+
+	if !verified {
+		return fmt.Errorf("keys not signed by any verify key")
+	}
+
+	return nil
+}
+
+// checkFederationTarget queries the federation version and the server keys from target. The certificate is verified
+// against the host of the target URL by the TLS handshake.
+func (c Check) checkFederationTarget(ctx context.Context, log logr.Logger, target target, rep *report.Report) error {
+	var version federationVersion
+
+	baseURL := target.url.String()
+	hostPort := hostPort(target.url)
+	ipPort := target.addr.String()
+
+	if err := c.loadHTTP(ctx, baseURL+"/_matrix/federation/v1/version", hostPort, ipPort, &version); err != nil {
+		return fmt.Errorf("federation version: %w", err)
+	}
+
+	if version.Server.Name == "" {
+		return fmt.Errorf("federation version: no server name reported")
+	}
+
+	log.V(1).Info("federation server", "target", ipPort, "name", version.Server.Name, "version", version.Server.Version)
+
+	var keys json.RawMessage
+
+	if err := c.loadHTTP(ctx, baseURL+"/_matrix/key/v2/server", hostPort, ipPort, &keys); err != nil {
+		return fmt.Errorf("server keys: %w", err)
+	}
+
+	if err := c.verifyServerKeys(keys, rep); err != nil {
+		return fmt.Errorf("server keys: %w", err)
+	}
+
+	return nil
+}
+
+// checkFederation verifies the federation API on all federation targets of the domain. Failing backup targets only
+// cause warnings.
+func (c Check) checkFederation(ctx context.Context, log logr.Logger, rep *report.Report) error {
+	targets, err := c.resolveFederationTargets(ctx, rep)
+	if err != nil {
+		return fmt.Errorf("federation: %w", err)
+	}
+
+	if len(targets) == 0 {
+		return fmt.Errorf("federation: %w", netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range targets {
+		target := targets[i]
+
+		group.Go(func(ctx context.Context) error {
+			sub := rep.Sub("federation " + target.addr.String())
+
+			err := c.checkFederationTarget(ctx, log, target, sub)
+
+			switch {
+			case err != nil && target.backup:
+				sub.Warn("backup target failed: %v", err)
+			case err != nil:
+				return fmt.Errorf("federation %s: %w", target.addr, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
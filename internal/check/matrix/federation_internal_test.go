@@ -0,0 +1,188 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package matrix
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Parallel()
+
+	// Examples from the canonical JSON section of the matrix specification.
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`{}`, `{}`},
+		{`{"one": 1, "two": "Two"}`, `{"one":1,"two":"Two"}`},
+		{`{"b": "2", "a": "1"}`, `{"a":"1","b":"2"}`},
+		{`{"auth": {"success": true, "mxid": "@john.doe:example.com", "profile": {"display_name": "John Doe",
+			"three_pids": [{"medium": "email", "address": "john.doe@example.org"},
+			{"medium": "msisdn", "address": "123456789"}]}}}`,
+			`{"auth":{"mxid":"@john.doe:example.com","profile":{"display_name":"John Doe","three_pids":` +
+				`[{"address":"john.doe@example.org","medium":"email"},{"address":"123456789","medium":"msisdn"}]},` +
+				`"success":true}}`},
+		{`{"a": "日本語"}`, `{"a":"日本語"}`},
+		{`{"本": 2, "日": 1}`, `{"日":1,"本":2}`},
+		{`{"a": "日"}`, `{"a":"日"}`},
+		{`{"a": null}`, `{"a":null}`},
+		{`{"a": -0, "b": 1e10}`, `{"a":0,"b":10000000000}`},
+		{`{"a": "<&>"}`, `{"a":"<&>"}`},
+		{`{"a": [1.0, 2.5]}`, `{"a":[1,2.5]}`},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.want, func(t *testing.T) {
+			t.Parallel()
+
+			canonical, err := canonicalJSON([]byte(test.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(canonical) != test.want {
+				t.Errorf("canonicalJSON() = %s, want %s", canonical, test.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalJSONWithout(t *testing.T) {
+	t.Parallel()
+
+	canonical, err := canonicalJSON([]byte(`{"b": 1, "signatures": {}, "unsigned": {}, "a": {"signatures": 1}}`),
+		"signatures", "unsigned")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"a":{"signatures":1},"b":1}`; string(canonical) != want {
+		t.Errorf("canonicalJSON() = %s, want %s", canonical, want)
+	}
+
+	if _, err := canonicalJSON([]byte(`[]`)); err == nil {
+		t.Error("canonicalJSON() accepted an array")
+	}
+}
+
+// signedKeys returns a key response for example.org signed by a fresh key. The response is signed before extra
+// is added to it.
+func signedKeys(t *testing.T, validUntil time.Time, extra map[string]interface{}) []byte {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyKey := map[string]string{"key": base64.RawStdEncoding.EncodeToString(publicKey)}
+	keys := map[string]interface{}{
+		"server_name":     "example.org",
+		"valid_until_ts":  validUntil.UnixMilli(),
+		"verify_keys":     map[string]interface{}{"ed25519:a": verifyKey},
+		"old_verify_keys": map[string]interface{}{},
+		"unsigned":        map[string]interface{}{"age": 5},
+	}
+
+	raw, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := canonicalJSON(raw, "signatures", "unsigned")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys["signatures"] = map[string]interface{}{
+		"example.org": map[string]string{
+			"ed25519:a": base64.RawStdEncoding.EncodeToString(ed25519.Sign(privateKey, signed)),
+		},
+	}
+
+	for key, value := range extra {
+		keys[key] = value
+	}
+
+	if raw, err = json.Marshal(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	return raw
+}
+
+func TestVerifyServerKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		domain  string
+		raw     []byte
+		problem string
+	}{
+		{"valid", "example.org", signedKeys(t, time.Now().Add(24*time.Hour), nil), ""},
+		{"unsigned changed", "example.org", signedKeys(t, time.Now().Add(24*time.Hour),
+			map[string]interface{}{"unsigned": map[string]int{"age": 10}}), ""},
+		{"other domain", "example.com", signedKeys(t, time.Now().Add(24*time.Hour), nil), "keys belong to example.org"},
+		{"expired", "example.org", signedKeys(t, time.Now().Add(-time.Hour), nil), "keys expired"},
+		{"tampered", "example.org", signedKeys(t, time.Now().Add(24*time.Hour),
+			map[string]interface{}{"old_verify_keys": map[string]int{"x": 1}}), "invalid signature"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			check := Check{Domain: test.domain, KeyExpiryWarning: time.Hour}
+			err := check.verifyServerKeys(test.raw, &report.Report{})
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("verifyServerKeys() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("verifyServerKeys() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestVerifyServerKeysWarning(t *testing.T) {
+	t.Parallel()
+
+	validUntil := time.Now().Add(30 * time.Minute).Truncate(time.Millisecond)
+	check := Check{Domain: "example.org", KeyExpiryWarning: time.Hour}
+	rep := &report.Report{}
+
+	if err := check.verifyServerKeys(signedKeys(t, validUntil, nil), rep); err != nil {
+		t.Fatalf("verifyServerKeys() = %v", err)
+	}
+
+	want := "keys expire at " + validUntil.Format(time.RFC3339)
+	if warnings := rep.Warnings(); len(warnings) != 1 || warnings[0] != want {
+		t.Errorf("Warnings() = %q, want [%q]", warnings, want)
+	}
+}
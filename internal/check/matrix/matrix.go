@@ -23,74 +23,107 @@ import (
 	"net/url"
 	"time"
 
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
 	"eqrx.net/rungroup"
 	"github.com/go-logr/logr"
-	"github.com/miekg/dns"
 )
 
 // StatusOK is the value that synapse reports as health status when everything is good.
 const StatusOK = "OK"
 
+// target is a single address of a homeserver. Backup targets are only used by servers if the others fail, so their
+// failures are only warned about.
 type target struct {
-	url  url.URL
-	addr netip.AddrPort
-}
-
-type wellKnown struct {
-	Homeserver struct {
-		URL string `json:"base_url"`
-	} `json:"m.homeserver"`
+	url    url.URL
+	addr   netip.AddrPort
+	backup bool
 }
 
 // Check for testing if a homeserver is reachable via HTTPS.
 type Check struct {
-	IPV4         bool   `yaml:"ipv4"`
-	Domain       string `yaml:"domain"`
-	targetRRType uint16 `yaml:"-"`
-	network      string `yaml:"-"`
+	IPV4               bool                `yaml:"ipv4"`
+	AddressFamilies    string              `yaml:"addressFamilies"`
+	RequireAllFamilies bool                `yaml:"requireAllFamilies"`
+	Domain             string              `yaml:"domain"`
+	Certificates       tlscheck.Inspection `yaml:"certificates"`
+	Versions           Versions            `yaml:"versions"`
+	Require            Discovery           `yaml:"require"`
+	Federation         bool                `yaml:"federation"`
+	KeyExpiryWarning   time.Duration       `yaml:"keyExpiryWarning"`
+	RoundTrip          *RoundTrip          `yaml:"roundTrip"`
+	families           []netcheck.Family   `yaml:"-"`
+	targetRRType       uint16              `yaml:"-"`
+	network            string              `yaml:"-"`
 }
 
 // Setup the check by preparing often used values.
-func (c *Check) Setup() {
-	c.targetRRType = dns.TypeAAAA
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.KeyExpiryWarning == 0 {
+		c.KeyExpiryWarning = defaultKeyExpiryWarning
+	}
 
-	if c.IPV4 {
-		c.targetRRType = dns.TypeA
+	if err := c.Versions.Setup(); err != nil {
+		return err
 	}
 
-	c.network = "tcp6"
-	if c.IPV4 {
-		c.network = "tcp4"
+	if c.RoundTrip != nil {
+		return c.RoundTrip.Setup()
 	}
+
+	return nil
 }
 
-// Check resolved the well-known info and the SRV record of the given domain.
-// If both match all homeservers are connected to via HTTP.
-func (c Check) Check(ctx context.Context, log logr.Logger) error {
-	srvTargets, err := c.resolveSRVTargets(ctx)
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// Check discovers the client API of the domain like clients do and connects to all of its addresses. Their
+// certificates are inspected and their announced client API versions are verified.
+// If enabled, the federation API is verified too. This is done for each address family.
+// Federation discovery is also done without federation being enabled if one of its paths is required.
+// If configured, a message round trip through the client API is done once afterwards.
+func (c Check) Check(ctx context.Context, log logr.Logger, rep *report.Report) error {
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkFamily(ctx, log, rep)
+		})
 	if err != nil {
-		return fmt.Errorf("matrix: resolve SRV: %w", err)
+		return fmt.Errorf("matrix: %w", err)
 	}
 
-	wellKnownTargets, err := c.resolveWellKnownTargets(ctx)
-	if err != nil {
-		return fmt.Errorf("matrix: check well-known: %w", err)
+	if c.RoundTrip != nil {
+		if err := c.RoundTrip.run(ctx, c.network, rep); err != nil {
+			return fmt.Errorf("matrix: round trip: %w", err)
+		}
 	}
 
-	targets := []target{}
+	return nil
+}
 
-	for _, newTarget := range append(srvTargets, wellKnownTargets...) {
-		exists := false
-		for oldIdx := range targets {
-			exists = targets[oldIdx] == newTarget
-			if exists {
-				break
-			}
-		}
+// checkFamily checks the client and federation API for the address family of c.
+func (c Check) checkFamily(ctx context.Context, log logr.Logger, rep *report.Report) error {
+	targets, err := c.resolveClientTargets(ctx, rep)
+	if err != nil {
+		return err
+	}
 
-		if !exists {
-			targets = append(targets, newTarget)
-		}
+	if len(targets) == 0 {
+		return fmt.Errorf("client API: %w", netcheck.ErrNoAddresses)
 	}
 
 	group := rungroup.New(ctx)
@@ -100,7 +133,7 @@ func (c Check) Check(ctx context.Context, log logr.Logger) error {
 		ipPort := targets[i].addr
 
 		group.Go(func(ctx context.Context) error {
-			err = c.connect(ctx, url, ipPort)
+			err := c.connect(ctx, url, ipPort, rep.Sub(url.Host+" "+ipPort.String()))
 			if err != nil {
 				return fmt.Errorf("connect to server: %w", err)
 			}
@@ -110,23 +143,29 @@ func (c Check) Check(ctx context.Context, log logr.Logger) error {
 	}
 
 	if err := group.Wait(); err != nil {
-		return fmt.Errorf("matrix: %w", err)
+		return err
+	}
+
+	switch {
+	case c.Federation:
+		return c.checkFederation(ctx, log, rep)
+	case c.Require.ServerWellKnown || c.Require.SRV:
+		if _, err := c.resolveFederationTargets(ctx, rep); err != nil {
+			return fmt.Errorf("federation: %w", err)
+		}
 	}
 
 	return nil
 }
 
 func (c Check) httpClient(toAddr, fromAddr string) *http.Client {
-	network := "tcp6"
-	if c.IPV4 {
-		network = "tcp4"
-	}
+	network := c.network
 
 	transport := &http.Transport{
 		IdleConnTimeout: 1 * time.Second,
 		DialContext: func(ctx context.Context, _, actual string) (net.Conn, error) {
 			if actual != fromAddr {
-				panic(fmt.Sprintf("expected to be called with %s, got %s", fromAddr, actual))
+				return nil, fmt.Errorf("dial %s: only %s is pinned", actual, fromAddr)
 			}
 
 			return (&net.Dialer{}).DialContext(ctx, network, toAddr)
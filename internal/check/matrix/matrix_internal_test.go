@@ -0,0 +1,35 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package matrix
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTTPClientPinned(t *testing.T) {
+	t.Parallel()
+
+	client := Check{network: "tcp"}.httpClient("127.0.0.1:1", "example.org:443")
+
+	resp, err := client.Get("https://example.com/")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("Get() dialed an address that is not pinned")
+	}
+
+	if !strings.Contains(err.Error(), "only example.org:443 is pinned") {
+		t.Errorf("Get() = %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/service"
+)
+
+const (
+	// defaultCredsName is the name of the systemd credentials the round trip loads if nothing else is configured.
+	// It is the same the matrix sink uses, so both can share a bot account.
+	defaultCredsName = "matrix"
+	// defaultRoundTripDeadline is how long a message may take to be synced back if nothing else is configured.
+	defaultRoundTripDeadline = 30 * time.Second
+	// syncTimeout caps how long a single sync request is held open by the server.
+	syncTimeout = 10 * time.Second
+)
+
+// Credentials contains information needed to log into a matrix server.
+type Credentials struct {
+	Homeserver string `yaml:"homeserver"`
+	Token      string `yaml:"token"`
+}
+
+// RoundTrip logs into a homeserver with a bot token, sends a message into a canary room and waits until it is synced
+// back.
+type RoundTrip struct {
+	CredsName string        `yaml:"credsName"`
+	Room      string        `yaml:"room"`
+	Deadline  time.Duration `yaml:"deadline"`
+	creds     Credentials   `yaml:"-"`
+}
+
+type whoamiResponse struct {
+	UserID string `json:"user_id"`
+}
+
+type sendResponse struct {
+	EventID string `json:"event_id"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []struct {
+					EventID string `json:"event_id"`
+				} `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+// Setup loads the credentials and fills in defaults.
+func (r *RoundTrip) Setup() error {
+	if r.Room == "" {
+		return fmt.Errorf("round trip: no room given")
+	}
+
+	if r.CredsName == "" {
+		r.CredsName = defaultCredsName
+	}
+
+	if r.Deadline == 0 {
+		r.Deadline = defaultRoundTripDeadline
+	}
+
+	if err := service.UnmarshalYAMLCreds(r.CredsName, &r.creds); err != nil {
+		return fmt.Errorf("round trip: credentials: %w", err)
+	}
+
+	return nil
+}
+
+// do sends a client API request and decodes the JSON response into dst.
+func (r RoundTrip) do(ctx context.Context, client *http.Client, method, path string, body, dst interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			panic(fmt.Sprintf("encode request: %v", err))
+		}
+
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, r.creds.Homeserver+path, reader)
+	if err != nil {
+		return fmt.Errorf("create http request: %w", err)
+	}
+
+	request.Header.Set("Authorization", "Bearer "+r.creds.Token)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("execute http request: %w", err)
+	}
+
+	readErr := json.NewDecoder(response.Body).Decode(dst)
+
+	closeErr := response.Body.Close()
+
+	switch {
+	case response.StatusCode < 200 || response.StatusCode >= 300:
+		return fmt.Errorf("unexpected http response status: %v", response.StatusCode)
+	case readErr != nil:
+		return fmt.Errorf("read body: %w", readErr)
+	case closeErr != nil:
+		return fmt.Errorf("close body: %w", closeErr)
+	default:
+		return nil
+	}
+}
+
+// sync performs a sync request limited to the canary room and returns the response.
+func (r RoundTrip) sync(
+	ctx context.Context, client *http.Client, since string, timeout time.Duration,
+) (syncResponse, error) {
+	room, err := json.Marshal(r.Room)
+	if err != nil {
+		panic(fmt.Sprintf("encode room: %v", err))
+	}
+
+	filter := `{"room":{"rooms":[` + string(room) + `],"timeline":{"limit":10}},` +
+		`"presence":{"types":[]},"account_data":{"types":[]}}`
+
+	query := url.Values{"filter": {filter}, "timeout": {strconv.FormatInt(timeout.Milliseconds(), 10)}}
+	if since != "" {
+		query.Set("since", since)
+	}
+
+	var response syncResponse
+
+	if err := r.do(ctx, client, http.MethodGet, "/_matrix/client/v3/sync?"+query.Encode(), nil, &response); err != nil {
+		return response, fmt.Errorf("sync: %w", err)
+	}
+
+	return response, nil
+}
+
+// run verifies the login, sends a message into the canary room and syncs until it shows up. The time between sending
+// and receiving is reported as round trip latency.
+func (r RoundTrip) run(ctx context.Context, network string, rep *report.Report) error {
+	client := &http.Client{Transport: &http.Transport{
+		IdleConnTimeout: 1 * time.Second,
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+
+	var versions versionsResponse
+	if err := r.do(ctx, client, http.MethodGet, versionsPath, nil, &versions); err != nil {
+		return fmt.Errorf("versions: %w", err)
+	}
+
+	if len(versions.Versions) == 0 {
+		return fmt.Errorf("versions: none supported")
+	}
+
+	var whoami whoamiResponse
+	if err := r.do(ctx, client, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("whoami: %w", err)
+	}
+
+	initial, err := r.sync(ctx, client, "", 0)
+	if err != nil {
+		return err
+	}
+
+	txnBytes := make([]byte, 16)
+	if _, err := rand.Read(txnBytes); err != nil {
+		panic(fmt.Sprintf("read random: %v", err))
+	}
+
+	txnID := hex.EncodeToString(txnBytes)
+	message := map[string]string{"msgtype": "m.notice", "body": "healthcheck round trip " + txnID}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(r.Room) + "/send/m.room.message/" + txnID
+
+	var sent sendResponse
+
+	sentAt := time.Now()
+
+	if err := r.do(ctx, client, http.MethodPut, path, message, &sent); err != nil {
+		return fmt.Errorf("send as %s: %w", whoami.UserID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Deadline)
+	defer cancel()
+
+	for since := initial.NextBatch; ; {
+		response, err := r.sync(ctx, client, since, syncTimeout)
+		if err != nil {
+			return fmt.Errorf("message %s did not arrive: %w", sent.EventID, err)
+		}
+
+		for _, event := range response.Rooms.Join[r.Room].Timeline.Events {
+			if event.EventID == sent.EventID {
+				rep.Metric("roundtrip_latency", time.Since(sentAt).Seconds(), "s")
+
+				return nil
+			}
+		}
+
+		since = response.NextBatch
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package matrix
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// versionsPath is the client API endpoint listing supported spec versions.
+const versionsPath = "/_matrix/client/versions"
+
+// Versions are assertions on the client API versions a homeserver announces.
+type Versions struct {
+	// Min is the lowest spec version the server needs to support, like "v1.2".
+	Min string `yaml:"min"`
+	// UnstableFeatures all need to be announced as enabled.
+	UnstableFeatures []string    `yaml:"unstableFeatures"`
+	min              specVersion `yaml:"-"`
+}
+
+type versionsResponse struct {
+	Versions         []string        `json:"versions"`
+	UnstableFeatures map[string]bool `json:"unstable_features"`
+}
+
+// specVersion is a parsed matrix spec version. Legacy versions like "r0.6.1" have major version 0.
+type specVersion struct {
+	major, minor, patch int
+}
+
+func parseSpecVersion(raw string) (specVersion, error) {
+	var version specVersion
+
+	switch {
+	case strings.HasPrefix(raw, "r0."):
+		parts := strings.Split(strings.TrimPrefix(raw, "r0."), ".")
+		if len(parts) != 2 {
+			return version, fmt.Errorf("spec version %s: malformed", raw)
+		}
+
+		minor, minorErr := strconv.Atoi(parts[0])
+		patch, patchErr := strconv.Atoi(parts[1])
+
+		if minorErr != nil || patchErr != nil {
+			return version, fmt.Errorf("spec version %s: malformed", raw)
+		}
+
+		return specVersion{0, minor, patch}, nil
+	case strings.HasPrefix(raw, "v"):
+		parts := strings.Split(strings.TrimPrefix(raw, "v"), ".")
+		if len(parts) != 2 {
+			return version, fmt.Errorf("spec version %s: malformed", raw)
+		}
+
+		major, majorErr := strconv.Atoi(parts[0])
+		minor, minorErr := strconv.Atoi(parts[1])
+
+		if majorErr != nil || minorErr != nil {
+			return version, fmt.Errorf("spec version %s: malformed", raw)
+		}
+
+		return specVersion{major, minor, 0}, nil
+	default:
+		return version, fmt.Errorf("spec version %s: unknown format", raw)
+	}
+}
+
+func (v specVersion) less(other specVersion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+
+	return v.patch < other.patch
+}
+
+// Setup parses the minimal version.
+func (v *Versions) Setup() error {
+	if v.Min == "" {
+		return nil
+	}
+
+	parsed, err := parseSpecVersion(v.Min)
+	if err != nil {
+		return fmt.Errorf("versions: %w", err)
+	}
+
+	v.min = parsed
+
+	return nil
+}
+
+// verify notes the announced versions and checks them against the assertions.
+// Versions the check does not understand are ignored.
+func (v Versions) verify(response versionsResponse, rep *report.Report) error {
+	if len(response.Versions) == 0 {
+		return fmt.Errorf("no spec versions announced")
+	}
+
+	rep.Note("spec versions %s", strings.Join(response.Versions, ", "))
+
+	if v.Min != "" {
+		supported := false
+
+		for _, raw := range response.Versions {
+			version, err := parseSpecVersion(raw)
+			if err == nil && !version.less(v.min) {
+				supported = true
+
+				break
+			}
+		}
+
+		if !supported {
+			return fmt.Errorf("spec version %s not supported", v.Min)
+		}
+	}
+
+	missing := []string{}
+
+	for _, feature := range v.UnstableFeatures {
+		if !response.UnstableFeatures[feature] {
+			missing = append(missing, feature)
+		}
+	}
+
+	if len(missing) != 0 {
+		sort.Strings(missing)
+
+		return fmt.Errorf("unstable features not enabled: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -16,80 +16,57 @@ package matrix
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
-	"net/netip"
-	"net/url"
-	"strconv"
-)
-
-func (c Check) resolveWellKnownTargets(ctx context.Context) ([]target, error) {
-	requestURL := "https://" + c.Domain + "/.well-known/matrix/client"
-
-	addrs, err := c.resolveAddr(ctx, c.Domain+".")
-	if err != nil {
-		return nil, err
-	}
-
-	if len(addrs) == 0 {
-		return nil, fmt.Errorf("addr not found")
-	}
-
-	targets := []target{}
 
-	for i := range addrs {
-		newTargets, err := c.resolveWellKnownTarget(ctx, requestURL, addrs[i])
-		if err != nil {
-			return nil, err
-		}
-
-		targets = append(targets, newTargets...)
-	}
+	"eqrx.net/healthcheck/internal/check/netcheck"
+)
 
-	if len(targets) == 0 {
-		return nil, fmt.Errorf("addr not found")
-	}
+// errNotFound is returned by loadHTTP if the server responds with 404 and by loadWellKnown if the domain has no
+// addresses to fetch the well-known from.
+var errNotFound = errors.New("not found")
 
-	return targets, nil
+type clientWellKnown struct {
+	Homeserver struct {
+		URL string `json:"base_url"`
+	} `json:"m.homeserver"`
 }
 
-func (c Check) resolveWellKnownTarget(ctx context.Context, requestURL string, addr netip.Addr) ([]target, error) {
-	var wellKnown wellKnown
-
-	hostPort := net.JoinHostPort(c.Domain, "443")
-	hostPortResolved := net.JoinHostPort(addr.String(), "443")
-
-	if err := c.loadHTTP(ctx, requestURL, hostPort, hostPortResolved, &wellKnown); err != nil {
-		return nil, fmt.Errorf("%s: %w", hostPortResolved, err)
-	}
+type serverWellKnown struct {
+	Server string `json:"m.server"`
+}
 
-	url, err := url.Parse(wellKnown.Homeserver.URL)
+// loadWellKnown fetches the well-known document of the given kind from every address of the domain. All addresses
+// need to serve it, dst contains the content served by the last one.
+func (c Check) loadWellKnown(ctx context.Context, kind string, dst interface{}) error {
+	host, _, err := net.SplitHostPort(c.Domain)
 	if err != nil {
-		return nil, fmt.Errorf("url: %w", err)
+		host = c.Domain
 	}
 
-	hostPart, portPart, err := net.SplitHostPort(url.Host)
+	addrs, err := netcheck.Resolve(ctx, host, c.targetRRType)
 	if err != nil {
-		return nil, fmt.Errorf("url: %w", err)
+		return fmt.Errorf("resolve %s: %w", host, err)
 	}
 
-	addrs, err := c.resolveAddr(ctx, hostPart+".")
-	if err != nil {
-		return nil, err
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s has no addresses: %w", host, errNotFound)
 	}
 
-	port, err := strconv.Atoi(portPart)
-	if err != nil {
-		return nil, fmt.Errorf("url: %w", err)
-	}
+	requestURL := "https://" + host + "/.well-known/matrix/" + kind
+	hostPort := net.JoinHostPort(host, "443")
 
-	targets := []target{}
 	for _, addr := range addrs {
-		targets = append(targets, target{*url, netip.AddrPortFrom(addr, uint16(port))})
+		ipPort := net.JoinHostPort(addr.String(), "443")
+
+		if err := c.loadHTTP(ctx, requestURL, hostPort, ipPort, dst); err != nil {
+			return fmt.Errorf("%s: %w", ipPort, err)
+		}
 	}
 
-	return targets, nil
+	return nil
 }
 
 func (c Check) loadHTTP(ctx context.Context, url, hostPort, ipPort string, dst interface{}) error {
@@ -108,6 +85,8 @@ func (c Check) loadHTTP(ctx context.Context, url, hostPort, ipPort string, dst i
 	closeErr := response.Body.Close()
 
 	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return errNotFound
 	case readErr != nil && closeErr != nil:
 		return fmt.Errorf("read body: %w; close body: %v", readErr, closeErr)
 	case readErr != nil:
@@ -0,0 +1,132 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package netcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/miekg/dns"
+)
+
+// ErrNoAddresses is returned by checks if the checked names have no addresses of the probed family.
+var ErrNoAddresses = errors.New("no addresses")
+
+// Family is an IP address family.
+type Family string
+
+const (
+	// FamilyV4 is IPv4.
+	FamilyV4 Family = "v4"
+	// FamilyV6 is IPv6.
+	FamilyV6 Family = "v6"
+	// familiesBoth selects both families in the addressFamilies option.
+	familiesBoth = "both"
+)
+
+// IPV4 returns if f is IPv4.
+func (f Family) IPV4() bool {
+	return f == FamilyV4
+}
+
+// RRType returns the DNS record type holding addresses of f.
+func (f Family) RRType() uint16 {
+	if f.IPV4() {
+		return dns.TypeA
+	}
+
+	return dns.TypeAAAA
+}
+
+// Network returns the network of f for the given protocol, like tcp4 for tcp.
+func (f Family) Network(proto string) string {
+	if f.IPV4() {
+		return proto + "4"
+	}
+
+	return proto + "6"
+}
+
+// Families parses the addressFamilies option of a check, which is v4, v6 or both. If the option is empty, the family
+// is selected by the ipv4 option instead.
+func Families(option string, ipv4 bool) ([]Family, error) {
+	switch option {
+	case "":
+		if ipv4 {
+			return []Family{FamilyV4}, nil
+		}
+
+		return []Family{FamilyV6}, nil
+	case string(FamilyV4):
+		return []Family{FamilyV4}, nil
+	case string(FamilyV6):
+		return []Family{FamilyV6}, nil
+	case familiesBoth:
+		return []Family{FamilyV4, FamilyV6}, nil
+	default:
+		return nil, fmt.Errorf("unknown address families %q", option)
+	}
+}
+
+// ForFamilies calls fn for each of the given families. With multiple families the calls run concurrently and
+// each gets a sub report named after its family. A family whose call fails with ErrNoAddresses only causes a warning,
+// unless requireAll is set or no family has addresses at all.
+func ForFamilies(
+	ctx context.Context, families []Family, requireAll bool, rep *report.Report,
+	fn func(context.Context, Family, *report.Report) error,
+) error {
+	if len(families) == 1 {
+		return fn(ctx, families[0], rep)
+	}
+
+	missing := make([]bool, len(families))
+	group := rungroup.New(ctx)
+
+	for i := range families {
+		i := i
+		family := families[i]
+
+		group.Go(func(ctx context.Context) error {
+			sub := rep.Sub(string(family))
+
+			err := fn(ctx, family, sub)
+
+			switch {
+			case errors.Is(err, ErrNoAddresses) && !requireAll:
+				missing[i] = true
+
+				sub.Warn("%v", err)
+			case err != nil:
+				return fmt.Errorf("%s: %w", family, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	for i := range missing {
+		if !missing[i] {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no family: %w", ErrNoAddresses)
+}
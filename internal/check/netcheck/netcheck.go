@@ -0,0 +1,99 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package netcheck contains network helpers shared by checks.
+package netcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"eqrx.net/rungroup"
+	"github.com/miekg/dns"
+)
+
+// DNSServer defines the port and address from which to query DNS records.
+// Set to cloudflare DNS to avoid as much record caching as possible.
+const DNSServer = "[2606:4700:4700::1111]:53"
+
+// Resolve returns the addresses of name for the given record type, which is either A or AAAA. IP literals are not
+// looked up but returned as they are if they belong to the family of the record type, IPv4-mapped IPv6 addresses
+// count as IPv4.
+func Resolve(ctx context.Context, name string, rrType uint16) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(name); err == nil {
+		if addr = addr.Unmap(); addr.Is4() == (rrType == dns.TypeA) {
+			return []netip.Addr{addr}, nil
+		}
+
+		return []netip.Addr{}, nil
+	}
+
+	question := (&dns.Msg{}).SetQuestion(dns.Fqdn(name), rrType)
+
+	answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, DNSServer)
+	if err != nil {
+		return nil, fmt.Errorf("dns exchange: %w", err)
+	}
+
+	addrs := []netip.Addr{}
+
+	for i := range answer.Answer {
+		var addr netip.Addr
+
+		var addrOk bool
+
+		switch record := answer.Answer[i].(type) {
+		case *dns.A:
+			if rrType == dns.TypeA {
+				addr, addrOk = netip.AddrFromSlice(record.A.To4())
+			}
+		case *dns.AAAA:
+			if rrType == dns.TypeAAAA {
+				addr, addrOk = netip.AddrFromSlice(record.AAAA)
+			}
+		}
+
+		if addrOk {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs, nil
+}
+
+// Dial connects to addr and calls fn with the connection. The connection is closed when fn returns or ctx is done.
+func Dial(ctx context.Context, network, addr string, fn func(net.Conn) error) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+
+	group := rungroup.New(ctx)
+
+	group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("close: %w", err)
+		}
+
+		return nil
+	})
+
+	group.Go(func(ctx context.Context) error { return fn(conn) })
+
+	return group.Wait()
+}
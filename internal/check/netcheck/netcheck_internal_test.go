@@ -0,0 +1,57 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package netcheck
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolveLiteral(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		rrType uint16
+		want   []netip.Addr
+	}{
+		{"192.0.2.1", dns.TypeA, []netip.Addr{netip.MustParseAddr("192.0.2.1")}},
+		{"192.0.2.1", dns.TypeAAAA, []netip.Addr{}},
+		{"2001:db8::1", dns.TypeAAAA, []netip.Addr{netip.MustParseAddr("2001:db8::1")}},
+		{"2001:db8::1", dns.TypeA, []netip.Addr{}},
+		{"::ffff:192.0.2.1", dns.TypeA, []netip.Addr{netip.MustParseAddr("192.0.2.1")}},
+		{"::ffff:192.0.2.1", dns.TypeAAAA, []netip.Addr{}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name+" "+dns.TypeToString[test.rrType], func(t *testing.T) {
+			t.Parallel()
+
+			addrs, err := Resolve(context.Background(), test.name, test.rrType)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(addrs, test.want) {
+				t.Errorf("Resolve() = %v, want %v", addrs, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package ntp contains a health check for the local clock offset against NTP servers.
+package ntp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// ntpPort is the port NTP servers listen on.
+	ntpPort = "123"
+	// defaultMaxOffset is the maximum offset of the local clock if nothing else is configured.
+	defaultMaxOffset = 100 * time.Millisecond
+	// maxStratum is the highest stratum of synchronized servers.
+	maxStratum = 15
+)
+
+// Check resolves NTP servers and sends an SNTP query to all their addresses. The offset of the local clock to each
+// of them must not exceed MaxOffset and their stratum not MaxStratum.
+// AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool              `yaml:"ipv4"`
+	AddressFamilies    string            `yaml:"addressFamilies"`
+	RequireAllFamilies bool              `yaml:"requireAllFamilies"`
+	Servers            []string          `yaml:"servers"`
+	MaxOffset          time.Duration     `yaml:"maxOffset"`
+	MaxStratum         int               `yaml:"maxStratum"`
+	families           []netcheck.Family `yaml:"-"`
+	targetRRType       uint16            `yaml:"-"`
+	network            string            `yaml:"-"`
+}
+
+// Setup prepares often used values. The offset defaults to 100ms and the stratum to the highest synchronized one.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("no servers given")
+	}
+
+	if c.MaxOffset == 0 {
+		c.MaxOffset = defaultMaxOffset
+	}
+
+	if c.MaxStratum == 0 {
+		c.MaxStratum = maxStratum
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("udp")
+
+	return c
+}
+
+// Check queries all servers for each address family.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
+		})
+	if err != nil {
+		return fmt.Errorf("ntp check: %w", err)
+	}
+
+	return nil
+}
+
+// checkServers resolves all servers and queries each of their addresses.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	group := rungroup.New(ctx)
+	queried := 0
+
+	for _, server := range c.Servers {
+		addrs, err := netcheck.Resolve(ctx, server, c.targetRRType)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", server, err)
+		}
+
+		for i := range addrs {
+			hostPort := net.JoinHostPort(addrs[i].String(), ntpPort)
+			sub := rep.Sub(server + " " + addrs[i].String())
+			queried++
+
+			group.Go(func(ctx context.Context) error {
+				if err := c.query(ctx, hostPort, sub); err != nil {
+					return fmt.Errorf("query %s: %w", hostPort, err)
+				}
+
+				return nil
+			}, rungroup.NeverCancel)
+		}
+	}
+
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	if queried == 0 {
+		return fmt.Errorf("servers: %w", netcheck.ErrNoAddresses)
+	}
+
+	return nil
+}
+
+// query sends an SNTP query to addr and verifies the offset and stratum.
+func (c Check) query(ctx context.Context, addr string, rep *report.Report) error {
+	return netcheck.Dial(ctx, c.network, addr, func(conn net.Conn) error {
+		sample, err := query(conn)
+		if err != nil {
+			return err
+		}
+
+		rep.Metric("offset", sample.offset.Seconds(), "s")
+		rep.Metric("delay", sample.delay.Seconds(), "s")
+		rep.Metric("stratum", float64(sample.stratum), "")
+
+		offset := sample.offset
+		if offset < 0 {
+			offset = -offset
+		}
+
+		if offset > c.MaxOffset {
+			return fmt.Errorf("clock offset %s exceeds %s", sample.offset, c.MaxOffset)
+		}
+
+		if sample.stratum > c.MaxStratum {
+			return fmt.Errorf("stratum %d exceeds %d", sample.stratum, c.MaxStratum)
+		}
+
+		return nil
+	})
+}
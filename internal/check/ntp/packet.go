@@ -0,0 +1,111 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ntp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// packetSize is the size of an SNTP packet without extensions.
+	packetSize = 48
+	// clientHeader is leap indicator 0, version 4 and mode client.
+	clientHeader = 4<<3 | 3
+	// modeServer is the mode of server replies.
+	modeServer = 4
+	// leapUnsynchronized is the leap indicator of servers without synchronized clock.
+	leapUnsynchronized = 3
+	// eraOffset is the number of seconds between the NTP and the unix epoch.
+	eraOffset = 2208988800
+)
+
+// sample is the result of a single SNTP exchange as defined by RFC 4330.
+type sample struct {
+	stratum int
+	offset  time.Duration
+	delay   time.Duration
+}
+
+// ntpTime converts an NTP timestamp to time. Timestamps with the highest bit unset are assumed to belong to era 1,
+// which starts in 2036.
+func ntpTime(raw []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(raw))
+	fraction := int64(binary.BigEndian.Uint32(raw[4:]))
+
+	if seconds < 1<<31 {
+		seconds += 1 << 32
+	}
+
+	return time.Unix(seconds-eraOffset, fraction*int64(time.Second)>>32)
+}
+
+// query sends a client request over conn and evaluates the reply. The transmit timestamp of the request is random,
+// so the reply can be matched without revealing the local clock.
+func query(conn net.Conn) (sample, error) {
+	request := make([]byte, packetSize)
+	request[0] = clientHeader
+
+	if _, err := rand.Read(request[40:]); err != nil {
+		return sample{}, fmt.Errorf("generate token: %w", err)
+	}
+
+	sent := time.Now()
+
+	if _, err := conn.Write(request); err != nil {
+		return sample{}, fmt.Errorf("send: %w", err)
+	}
+
+	reply := make([]byte, 1024)
+
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return sample{}, fmt.Errorf("receive: %w", err)
+		}
+
+		received := time.Now()
+
+		if n < packetSize || string(reply[24:32]) != string(request[40:]) {
+			continue
+		}
+
+		return evaluate(reply[:n], sent, received)
+	}
+}
+
+// evaluate checks the header of a reply and calculates the clock offset and round trip delay from its timestamps.
+func evaluate(reply []byte, sent, received time.Time) (sample, error) {
+	leap, mode, stratum := reply[0]>>6, reply[0]&7, int(reply[1])
+
+	switch {
+	case mode != modeServer:
+		return sample{}, fmt.Errorf("unexpected mode %d", mode)
+	case stratum == 0:
+		return sample{}, fmt.Errorf("kiss of death %q", reply[12:16])
+	case leap == leapUnsynchronized:
+		return sample{}, fmt.Errorf("server clock not synchronized")
+	}
+
+	serverReceived, serverSent := ntpTime(reply[32:40]), ntpTime(reply[40:48])
+
+	return sample{
+		stratum: stratum,
+		offset:  (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2,
+		delay:   received.Sub(sent) - serverSent.Sub(serverReceived),
+	}, nil
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ntp
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ntpStamp encodes when as NTP timestamp.
+func ntpStamp(when time.Time) []byte {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint32(raw, uint32(when.Unix()+eraOffset))
+	binary.BigEndian.PutUint32(raw[4:], uint32((int64(when.Nanosecond())<<32)/int64(time.Second)))
+
+	return raw
+}
+
+// reply returns a server reply with the given header that received the request at serverReceived and sent the reply
+// at serverSent.
+func reply(header, stratum byte, serverReceived, serverSent time.Time) []byte {
+	packet := make([]byte, packetSize)
+	packet[0], packet[1] = header, stratum
+	copy(packet[12:16], "RATE")
+	copy(packet[32:40], ntpStamp(serverReceived))
+	copy(packet[40:48], ntpStamp(serverSent))
+
+	return packet
+}
+
+func TestNTPTime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		seconds  uint32
+		fraction uint32
+		want     time.Time
+	}{
+		{"unix epoch", eraOffset, 0, time.Unix(0, 0)},
+		{"half second", eraOffset, 1 << 31, time.Unix(0, int64(time.Second/2))},
+		{"end of era 0", 1<<32 - 1, 0, time.Date(2036, 2, 7, 6, 28, 15, 0, time.UTC)},
+		{"start of era 1", 0, 0, time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC)},
+		{"era 0 pivot", 1 << 31, 0, time.Date(1968, 1, 20, 3, 14, 8, 0, time.UTC)},
+		{"era 1 before pivot", 1<<31 - 1, 0, time.Date(2104, 2, 26, 9, 42, 23, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw := make([]byte, 8)
+			binary.BigEndian.PutUint32(raw, test.seconds)
+			binary.BigEndian.PutUint32(raw[4:], test.fraction)
+
+			if got := ntpTime(raw); !got.Equal(test.want) {
+				t.Errorf("ntpTime() = %s, want %s", got.UTC(), test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	received := sent.Add(30 * time.Millisecond)
+
+	// The server clock is 100ms ahead and takes 10ms to answer, the network takes 10ms to each direction.
+	serverReceived := sent.Add(110 * time.Millisecond)
+	serverSent := serverReceived.Add(10 * time.Millisecond)
+
+	tests := []struct {
+		name    string
+		reply   []byte
+		problem string
+	}{
+		{"synchronized", reply(4<<3|modeServer, 2, serverReceived, serverSent), ""},
+		{"leap second pending", reply(1<<6|4<<3|modeServer, 2, serverReceived, serverSent), ""},
+		{"client mode", reply(4<<3|3, 2, serverReceived, serverSent), "unexpected mode 3"},
+		{"kiss of death", reply(4<<3|modeServer, 0, serverReceived, serverSent), `kiss of death "RATE"`},
+		{"unsynchronized", reply(leapUnsynchronized<<6|4<<3|modeServer, 2, serverReceived, serverSent), "not synchronized"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			sample, err := evaluate(test.reply, sent, received)
+
+			switch {
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Fatalf("evaluate() = %v, want %q", err, test.problem)
+			case test.problem != "":
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if sample.stratum != 2 {
+				t.Errorf("stratum = %d, want 2", sample.stratum)
+			}
+
+			// NTP timestamps resolve fractions of about 233ps, conversion rounds down to the nanosecond.
+			if diff := sample.offset - 100*time.Millisecond; diff > time.Microsecond || diff < -time.Microsecond {
+				t.Errorf("offset = %s, want 100ms", sample.offset)
+			}
+
+			if diff := sample.delay - 20*time.Millisecond; diff > time.Microsecond || diff < -time.Microsecond {
+				t.Errorf("delay = %s, want 20ms", sample.delay)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+
+		request := make([]byte, packetSize)
+		if _, err := server.Read(request); err != nil {
+			t.Errorf("read request: %v", err)
+
+			return
+		}
+
+		if request[0] != clientHeader {
+			t.Errorf("request header = %#x", request[0])
+		}
+
+		now := time.Now()
+
+		// Replies that are too short or do not carry the token of the request are ignored.
+		stale := reply(4<<3|modeServer, 1, now, now)
+		for _, packet := range [][]byte{stale[:packetSize-1], stale} {
+			if _, err := server.Write(packet); err != nil {
+				t.Errorf("write reply: %v", err)
+
+				return
+			}
+		}
+
+		answer := reply(4<<3|modeServer, 1, now, now)
+		copy(answer[24:32], request[40:48])
+
+		if _, err := server.Write(answer); err != nil {
+			t.Errorf("write reply: %v", err)
+		}
+	}()
+
+	sample, err := query(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sample.stratum != 1 || sample.offset > time.Second || sample.offset < -time.Second {
+		t.Errorf("query() = %+v", sample)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ping
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"eqrx.net/rungroup"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Protocol numbers of ICMP and ICMPv6 needed to parse messages.
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// sendTimes records when each echo request was sent. It may be used concurrently.
+type sendTimes struct {
+	mutex sync.Mutex
+	times map[int]time.Time
+}
+
+// record stores the current time as send time of the request with the given sequence number.
+func (s *sendTimes) record(seq int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.times[seq] = time.Now()
+}
+
+// rtt returns the round trip time of the request with the given sequence number answered at received. It returns
+// false if the request was not sent or already answered.
+func (s *sendTimes) rtt(seq int, received time.Time) (time.Duration, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent, ok := s.times[seq]
+	if !ok {
+		return 0, false
+	}
+
+	delete(s.times, seq)
+
+	return received.Sub(sent), true
+}
+
+// socket is an ICMP socket for one address family.
+type socket struct {
+	conn       *icmp.PacketConn
+	privileged bool
+	protocol   int
+	request    icmp.Type
+	reply      icmp.Type
+}
+
+// listen opens an unprivileged ICMP datagram socket for the family of addr and falls back to a raw socket if that
+// is not permitted.
+func listen(addr netip.Addr) (socket, error) {
+	sock := socket{protocol: protocolICMP, request: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	unprivileged, privileged, local := "udp4", "ip4:icmp", "0.0.0.0"
+
+	if !addr.Is4() {
+		sock = socket{protocol: protocolICMPv6, request: ipv6.ICMPTypeEchoRequest, reply: ipv6.ICMPTypeEchoReply}
+		unprivileged, privileged, local = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(unprivileged, local)
+	if err == nil {
+		sock.conn = conn
+
+		return sock, nil
+	}
+
+	conn, rawErr := icmp.ListenPacket(privileged, local)
+	if rawErr != nil {
+		return socket{}, fmt.Errorf("listen: %v; raw: %w", err, rawErr)
+	}
+
+	sock.conn, sock.privileged = conn, true
+
+	return sock, nil
+}
+
+// destination returns the address to send packets to, which depends on the kind of socket.
+func (s socket) destination(addr netip.Addr) net.Addr {
+	if s.privileged {
+		return &net.IPAddr{IP: addr.AsSlice()}
+	}
+
+	return &net.UDPAddr{IP: addr.AsSlice()}
+}
+
+// ping sends the configured number of echo requests to addr and returns the round trip times of all replies that
+// were received in time. Requests carry a random token to recognize replies, round trip times are measured with the
+// monotonic clock against the send time of the sequence number.
+func (c Check) ping(ctx context.Context, addr netip.Addr) ([]time.Duration, error) {
+	sock, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		panic(fmt.Sprintf("read random: %v", err))
+	}
+
+	id := os.Getpid() & 0xffff
+	deadline := time.Now().Add(time.Duration(c.Count)*spacing + c.Wait)
+
+	if err := sock.conn.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("set deadline: %w", err)
+	}
+
+	var rtts []time.Duration
+
+	sent := &sendTimes{times: map[int]time.Time{}}
+	group := rungroup.New(ctx)
+
+	group.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+
+		if err := sock.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("close: %w", err)
+		}
+
+		return nil
+	})
+
+	group.Go(func(ctx context.Context) error {
+		return c.send(ctx, sock, addr, id, token, sent)
+	}, rungroup.NeverCancel)
+
+	group.Go(func(ctx context.Context) error {
+		var err error
+
+		rtts, err = c.receive(sock, id, token, sent)
+
+		return err
+	})
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	return rtts, nil
+}
+
+// send writes the echo requests with the configured spacing and records their send times.
+func (c Check) send(ctx context.Context, sock socket, addr netip.Addr, id int, token []byte, sent *sendTimes) error {
+	for seq := 0; seq < c.Count; seq++ {
+		message := icmp.Message{Type: sock.request, Body: &icmp.Echo{ID: id, Seq: seq, Data: token}}
+
+		packet, err := message.Marshal(nil)
+		if err != nil {
+			panic(fmt.Sprintf("marshal echo request: %v", err))
+		}
+
+		sent.record(seq)
+
+		if _, err := sock.conn.WriteTo(packet, sock.destination(addr)); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(spacing):
+		}
+	}
+
+	return nil
+}
+
+// receive reads echo replies until all requests are answered or the read deadline passes.
+func (c Check) receive(sock socket, id int, token []byte, sent *sendTimes) ([]time.Duration, error) {
+	rtts := []time.Duration{}
+	buffer := make([]byte, 1500)
+
+	for len(rtts) < c.Count {
+		n, _, err := sock.conn.ReadFrom(buffer)
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return rtts, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("receive: %w", err)
+		}
+
+		received := time.Now()
+
+		seq, ok := sock.match(buffer[:n], id, token)
+		if !ok {
+			continue
+		}
+
+		if rtt, ok := sent.rtt(seq, received); ok {
+			rtts = append(rtts, rtt)
+		}
+	}
+
+	return rtts, nil
+}
+
+// match returns the sequence number of packet if it is an echo reply to one of our requests. The ID is only compared
+// on raw sockets since the kernel assigns its own to datagram sockets.
+func (s socket) match(packet []byte, id int, token []byte) (int, bool) {
+	message, err := icmp.ParseMessage(s.protocol, packet)
+	if err != nil || message.Type != s.reply {
+		return 0, false
+	}
+
+	echo, ok := message.Body.(*icmp.Echo)
+	if !ok || !bytes.Equal(echo.Data, token) || (s.privileged && echo.ID != id) {
+		return 0, false
+	}
+
+	return echo.Seq, true
+}
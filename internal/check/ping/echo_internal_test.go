@@ -0,0 +1,97 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ping
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// packet marshals an echo message.
+func packet(t *testing.T, kind icmp.Type, id, seq int, data []byte) []byte {
+	t.Helper()
+
+	raw, err := (&icmp.Message{Type: kind, Body: &icmp.Echo{ID: id, Seq: seq, Data: data}}).Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return raw
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	token := []byte("01234567")
+	v4 := socket{protocol: protocolICMP, request: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	v6 := socket{protocol: protocolICMPv6, request: ipv6.ICMPTypeEchoRequest, reply: ipv6.ICMPTypeEchoReply}
+	raw := v4
+	raw.privileged = true
+
+	tests := []struct {
+		name   string
+		sock   socket
+		packet []byte
+		seq    int
+		ok     bool
+	}{
+		{"v4 reply", v4, packet(t, ipv4.ICMPTypeEchoReply, 7, 3, token), 3, true},
+		{"v6 reply", v6, packet(t, ipv6.ICMPTypeEchoReply, 7, 4, token), 4, true},
+		{"kernel id on datagram socket", v4, packet(t, ipv4.ICMPTypeEchoReply, 99, 1, token), 1, true},
+		{"raw socket", raw, packet(t, ipv4.ICMPTypeEchoReply, 42, 2, token), 2, true},
+		{"foreign id on raw socket", raw, packet(t, ipv4.ICMPTypeEchoReply, 99, 2, token), 0, false},
+		{"request", v4, packet(t, ipv4.ICMPTypeEcho, 7, 1, token), 0, false},
+		{"foreign token", v4, packet(t, ipv4.ICMPTypeEchoReply, 7, 1, []byte("76543210")), 0, false},
+		{"truncated token", v4, packet(t, ipv4.ICMPTypeEchoReply, 7, 1, token[:4]), 0, false},
+		{"garbage", v4, []byte{0}, 0, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			seq, ok := test.sock.match(test.packet, 42, token)
+			if seq != test.seq || ok != test.ok {
+				t.Errorf("match() = %d, %t, want %d, %t", seq, ok, test.seq, test.ok)
+			}
+		})
+	}
+}
+
+func TestSendTimes(t *testing.T) {
+	t.Parallel()
+
+	sent := &sendTimes{times: map[int]time.Time{}}
+	sent.record(0)
+
+	received := time.Now().Add(5 * time.Millisecond)
+
+	if rtt, ok := sent.rtt(0, received); !ok || rtt < 5*time.Millisecond || rtt > time.Second {
+		t.Errorf("rtt() = %s, %t", rtt, ok)
+	}
+
+	if _, ok := sent.rtt(0, received); ok {
+		t.Error("rtt() accepted a duplicate reply")
+	}
+
+	if _, ok := sent.rtt(1, received); ok {
+		t.Error("rtt() accepted a reply to an unsent request")
+	}
+}
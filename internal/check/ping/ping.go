@@ -0,0 +1,177 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package ping contains health checks that send ICMP echo requests.
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// defaultCount is the number of echo requests sent to each address if nothing else is configured.
+	defaultCount = 5
+	// defaultWait is how long to wait for replies after the last request if nothing else is configured.
+	defaultWait = time.Second
+	// spacing is the time between two echo requests to the same address.
+	spacing = 100 * time.Millisecond
+)
+
+// Check sends ICMP echo requests to all addresses of a host and asserts packet loss and round trip times.
+// Unprivileged ICMP datagram sockets are used if the kernel permits them (see net.ipv4.ping_group_range),
+// otherwise raw sockets are tried, which require CAP_NET_RAW.
+// AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool              `yaml:"ipv4"`
+	AddressFamilies    string            `yaml:"addressFamilies"`
+	RequireAllFamilies bool              `yaml:"requireAllFamilies"`
+	Host               string            `yaml:"host"`
+	Count              int               `yaml:"count"`
+	Wait               time.Duration     `yaml:"wait"`
+	MaxLoss            float64           `yaml:"maxLoss"`
+	MaxRTT             time.Duration     `yaml:"maxRTT"`
+	families           []netcheck.Family `yaml:"-"`
+	targetRRType       uint16            `yaml:"-"`
+}
+
+// Setup prepares often used values.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Host == "" {
+		return fmt.Errorf("no host given")
+	}
+
+	if c.Count == 0 {
+		c.Count = defaultCount
+	}
+
+	if c.Wait == 0 {
+		c.Wait = defaultWait
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+
+	return c
+}
+
+// Check resolves the host for each address family and pings all its addresses. Statistics are reported per address.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
+		})
+	if err != nil {
+		return fmt.Errorf("icmp check: %w", err)
+	}
+
+	return nil
+}
+
+// checkServers resolves the host and pings all its addresses.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	addrs, err := netcheck.Resolve(ctx, c.Host, c.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", c.Host, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", c.Host, netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		addr := addrs[i]
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.evaluate(ctx, addr, rep.Sub(addr.String())); err != nil {
+				return fmt.Errorf("%s: %w", addr, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+// evaluate pings addr, reports the statistics and checks them against the thresholds.
+func (c Check) evaluate(ctx context.Context, addr netip.Addr, rep *report.Report) error {
+	rtts, err := c.ping(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	return c.assess(rtts, rep)
+}
+
+// assess reports the loss and round trip statistics of the replies to the configured number of requests and checks
+// them against the thresholds.
+func (c Check) assess(rtts []time.Duration, rep *report.Report) error {
+	loss := float64(c.Count-len(rtts)) / float64(c.Count) * 100
+
+	rep.Metric("loss", loss, "%")
+
+	if len(rtts) != 0 {
+		minRTT, maxRTT, sum := rtts[0], rtts[0], time.Duration(0)
+
+		for _, rtt := range rtts {
+			sum += rtt
+
+			if rtt < minRTT {
+				minRTT = rtt
+			}
+
+			if rtt > maxRTT {
+				maxRTT = rtt
+			}
+		}
+
+		avgRTT := sum / time.Duration(len(rtts))
+
+		rep.Metric("rtt_min", float64(minRTT)/float64(time.Millisecond), "ms")
+		rep.Metric("rtt_avg", float64(avgRTT)/float64(time.Millisecond), "ms")
+		rep.Metric("rtt_max", float64(maxRTT)/float64(time.Millisecond), "ms")
+
+		if c.MaxRTT != 0 && avgRTT > c.MaxRTT {
+			return fmt.Errorf("average round trip time %s exceeds %s", avgRTT, c.MaxRTT)
+		}
+	}
+
+	if loss > c.MaxLoss {
+		return fmt.Errorf("packet loss %.0f%% exceeds %.0f%%", loss, c.MaxLoss)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package ping
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+func TestAssess(t *testing.T) {
+	t.Parallel()
+
+	ms := time.Millisecond
+
+	tests := []struct {
+		name    string
+		check   Check
+		rtts    []time.Duration
+		problem string
+		metrics string
+	}{
+		{"all answered", Check{Count: 4, MaxRTT: 10 * ms}, []time.Duration{2 * ms, 4 * ms, 6 * ms, 8 * ms}, "",
+			"loss=0% rtt_min=2ms rtt_avg=5ms rtt_max=8ms"},
+		{"loss allowed", Check{Count: 4, MaxLoss: 25}, []time.Duration{ms, ms, ms}, "",
+			"loss=25% rtt_min=1ms rtt_avg=1ms rtt_max=1ms"},
+		{"loss", Check{Count: 4, MaxLoss: 20}, []time.Duration{ms, ms, ms}, "packet loss 25% exceeds 20%",
+			"loss=25% rtt_min=1ms rtt_avg=1ms rtt_max=1ms"},
+		{"slow", Check{Count: 2, MaxRTT: 10 * ms}, []time.Duration{5 * ms, 25 * ms},
+			"average round trip time 15ms exceeds 10ms", "loss=0% rtt_min=5ms rtt_avg=15ms rtt_max=25ms"},
+		{"no replies", Check{Count: 3}, nil, "packet loss 100% exceeds 0%", "loss=100%"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			rep := &report.Report{}
+			err := test.check.assess(test.rtts, rep)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("assess() = %v", err)
+			case test.problem != "" && (err == nil || err.Error() != test.problem):
+				t.Errorf("assess() = %v, want %q", err, test.problem)
+			}
+
+			metrics := []string{}
+			for _, metric := range rep.Metrics() {
+				metrics = append(metrics, metric.String())
+			}
+
+			if got := strings.Join(metrics, " "); got != test.metrics {
+				t.Errorf("metrics = %s, want %s", got, test.metrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package pop3
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// client is a minimal POP3 client that only knows what the health check needs.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newClient reads the server greeting from conn and returns a client using it.
+func newClient(conn net.Conn) (*client, error) {
+	client := &client{conn: conn, reader: bufio.NewReader(conn)}
+
+	if _, err := client.status(); err != nil {
+		return nil, fmt.Errorf("greeting: %w", err)
+	}
+
+	return client, nil
+}
+
+// status reads a status line and returns its text. An error is returned if it is not positive.
+func (c *client) status() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+
+	if !strings.HasPrefix(line, "+OK") {
+		return "", fmt.Errorf("server responded: %s", line)
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+}
+
+// command sends a command and returns the text of the positive status response.
+func (c *client) command(command string) (string, error) {
+	if _, err := c.conn.Write([]byte(command + "\r\n")); err != nil {
+		return "", fmt.Errorf("write command: %w", err)
+	}
+
+	return c.status()
+}
+
+// multiline sends a command that is answered with a multi-line response and returns its lines.
+func (c *client) multiline(command string) ([]string, error) {
+	if _, err := c.command(command); err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "." {
+			return lines, nil
+		}
+
+		lines = append(lines, strings.TrimPrefix(line, "."))
+	}
+}
+
+// capabilities returns the capabilities the server currently announces.
+func (c *client) capabilities() ([]string, error) {
+	lines, err := c.multiline("CAPA")
+	if err != nil {
+		return nil, fmt.Errorf("CAPA: %w", err)
+	}
+
+	return lines, nil
+}
+
+// startTLS asks the server to start TLS and upgrades the connection with the given handshake.
+func (c *client) startTLS(handshake func(net.Conn) (*tls.Conn, error)) error {
+	if _, err := c.command("STLS"); err != nil {
+		return fmt.Errorf("STLS: %w", err)
+	}
+
+	tlsConn, err := handshake(c.conn)
+	if err != nil {
+		return err
+	}
+
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+
+	return nil
+}
+
+// tlsConnectionState returns the state of the TLS connection, if there is one.
+func (c *client) tlsConnectionState() (tls.ConnectionState, bool) {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+
+	return tlsConn.ConnectionState(), true
+}
+
+// login authenticates with username and password and returns the number of messages and the size of the mailbox
+// in bytes as reported by STAT.
+func (c *client) login(username, password string) (int, int64, error) {
+	if _, err := c.command("USER " + username); err != nil {
+		return 0, 0, fmt.Errorf("USER: %w", err)
+	}
+
+	if _, err := c.command("PASS " + password); err != nil {
+		return 0, 0, fmt.Errorf("PASS: %w", err)
+	}
+
+	stat, err := c.command("STAT")
+	if err != nil {
+		return 0, 0, fmt.Errorf("STAT: %w", err)
+	}
+
+	fields := strings.Fields(stat)
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("STAT: malformed response: %s", stat)
+	}
+
+	messages, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("STAT: message count: %w", err)
+	}
+
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("STAT: size: %w", err)
+	}
+
+	return messages, size, nil
+}
+
+// quit ends the session.
+func (c *client) quit() error {
+	if _, err := c.command("QUIT"); err != nil {
+		return fmt.Errorf("QUIT: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package pop3
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exchange is a command the stand-in server expects and its reply.
+type exchange struct {
+	command string
+	reply   string
+}
+
+// pipe returns a client connection to a stand-in server that sends greeting and then answers the expected
+// commands in order. It stops at the first unexpected command. The test waits for the server to stop.
+func pipe(t *testing.T, greeting string, exchanges ...exchange) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		defer server.Close()
+
+		if _, err := io.WriteString(server, greeting); err != nil {
+			return
+		}
+
+		reader := bufio.NewReader(server)
+
+		for _, exchange := range exchanges {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			if line != exchange.command+"\r\n" {
+				t.Errorf("command = %q, want %q", line, exchange.command)
+
+				return
+			}
+
+			if _, err := io.WriteString(server, exchange.reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	return client
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	client, err := newClient(pipe(t, "+OK POP3 ready\r\n",
+		exchange{"CAPA", "+OK capabilities follow\r\nUSER\r\nSASL PLAIN\r\n..STUFFED\r\n.\r\n"},
+		exchange{"USER user", "+OK\r\n"},
+		exchange{"PASS secret", "+OK logged in\r\n"},
+		exchange{"STAT", "+OK 2 320\r\n"},
+		exchange{"QUIT", "+OK bye\r\n"},
+	))
+	if err != nil {
+		t.Fatalf("newClient() = %v", err)
+	}
+
+	capabilities, err := client.capabilities()
+	if want := []string{"USER", "SASL PLAIN", ".STUFFED"}; err != nil || !reflect.DeepEqual(capabilities, want) {
+		t.Fatalf("capabilities() = %q, %v, want %q", capabilities, err, want)
+	}
+
+	messages, size, err := client.login("user", "secret")
+	if err != nil || messages != 2 || size != 320 {
+		t.Fatalf("login() = %d, %d, %v, want 2, 320", messages, size, err)
+	}
+
+	if err := client.quit(); err != nil {
+		t.Fatalf("quit() = %v", err)
+	}
+}
+
+func TestClientFailures(t *testing.T) {
+	t.Parallel()
+
+	if _, err := newClient(pipe(t, "-ERR too busy\r\n")); err == nil ||
+		!strings.Contains(err.Error(), "greeting: server responded: -ERR too busy") {
+		t.Errorf("newClient() = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		exchanges []exchange
+		problem   string
+	}{
+		{"wrong password", []exchange{{"USER user", "+OK\r\n"}, {"PASS secret", "-ERR [AUTH] invalid\r\n"}},
+			"PASS: server responded: -ERR [AUTH] invalid"},
+		{"malformed stat", []exchange{{"USER user", "+OK\r\n"}, {"PASS secret", "+OK\r\n"}, {"STAT", "+OK 2\r\n"}},
+			"STAT: malformed response: 2"},
+		{"invalid count", []exchange{{"USER user", "+OK\r\n"}, {"PASS secret", "+OK\r\n"}, {"STAT", "+OK two 3\r\n"}},
+			"STAT: message count"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := newClient(pipe(t, "+OK ready\r\n", test.exchanges...))
+			if err != nil {
+				t.Fatalf("newClient() = %v", err)
+			}
+
+			if _, _, err := client.login("user", "secret"); err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Errorf("login() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
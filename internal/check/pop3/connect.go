@@ -0,0 +1,62 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package pop3
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// session runs the POP3 dialogue on conn.
+func (c Check) session(conn net.Conn, rep *report.Report) error {
+	client, err := newClient(conn)
+	if err != nil {
+		return err
+	}
+
+	if c.Service.Mode == tlscheck.ModeSTARTTLS {
+		if err := client.startTLS(c.Service.StartTLS); err != nil {
+			return err
+		}
+	}
+
+	capabilities, err := client.capabilities()
+	if err != nil {
+		return err
+	}
+
+	if state, ok := client.tlsConnectionState(); ok {
+		c.Service.Certificates.Inspect(state, rep)
+	}
+
+	if missing := tlscheck.MissingCapabilities(capabilities, c.Capabilities); len(missing) != 0 {
+		return fmt.Errorf("capabilities missing: %s", strings.Join(missing, ", "))
+	}
+
+	if creds := c.Service.Creds(); creds != nil {
+		messages, size, err := client.login(creds.Username, creds.Password)
+		if err != nil {
+			return err
+		}
+
+		rep.Metric("messages", float64(messages), "")
+		rep.Metric("mailbox_size", float64(size), "B")
+	}
+
+	return client.quit()
+}
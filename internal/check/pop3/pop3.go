@@ -0,0 +1,45 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package pop3 contains health checks for POP3 servers.
+package pop3
+
+import (
+	"context"
+	"fmt"
+
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// Check resolves a POP3 server, tests its TLS function and capabilities and optionally logs in to report the number
+// of messages and the size of the mailbox.
+type Check struct {
+	Service      tlscheck.Service `yaml:",inline"`
+	Capabilities []string         `yaml:"capabilities"`
+}
+
+// Setup prepares often used values and loads the credentials if configured.
+func (c *Check) Setup() error {
+	return c.Service.Setup("995", "110")
+}
+
+// Check resolves the host and connects to all its addresses.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if err := c.Service.Run(ctx, rep, c.session); err != nil {
+		return fmt.Errorf("pop3 check: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5" //nolint:gosec // Required by the md5 authentication of PostgreSQL.
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	// protocolVersion is version 3.0 of the frontend/backend protocol.
+	protocolVersion = 196608
+	// sslRequestCode requests a TLS handshake instead of a startup message.
+	sslRequestCode = 80877103
+	// messageLimit is the maximum size of a message accepted from the server.
+	messageLimit = 16 * 1024 * 1024
+)
+
+// Authentication request codes sent by the server.
+const (
+	authOK                = 0
+	authCleartextPassword = 3
+	authMD5Password       = 5
+	authSASL              = 10
+	authSASLContinue      = 11
+	authSASLFinal         = 12
+)
+
+// message is an outgoing message that is built up field by field.
+type message struct {
+	bytes.Buffer
+}
+
+func (m *message) writeInt32(value int32) {
+	_ = binary.Write(&m.Buffer, binary.BigEndian, value)
+}
+
+func (m *message) writeCString(value string) {
+	m.WriteString(value)
+	m.WriteByte(0)
+}
+
+// conn is a frontend connection to a PostgreSQL server.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newConn(netConn net.Conn) *conn {
+	return &conn{conn: netConn, reader: bufio.NewReader(netConn)}
+}
+
+// send writes a message with the given type. Messages without type, like the startup message, use type 0.
+func (c *conn) send(kind byte, msg *message) error {
+	header := []byte{}
+	if kind != 0 {
+		header = append(header, kind)
+	}
+
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(msg.Len()+4))
+	header = append(header, length...)
+
+	if _, err := c.conn.Write(append(header, msg.Bytes()...)); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+
+	return nil
+}
+
+// receive reads a message and returns its type and payload. Error responses are returned as error.
+func (c *conn) receive() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, fmt.Errorf("receive: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > messageLimit {
+		return 0, nil, fmt.Errorf("receive: invalid message length %d", length)
+	}
+
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, fmt.Errorf("receive: %w", err)
+	}
+
+	if header[0] == 'E' {
+		return 0, nil, parseError(payload)
+	}
+
+	return header[0], payload, nil
+}
+
+// parseError formats the fields of an error response.
+func parseError(payload []byte) error {
+	fields := map[byte]string{}
+
+	for len(payload) > 1 {
+		end := bytes.IndexByte(payload[1:], 0)
+		if end < 0 {
+			break
+		}
+
+		fields[payload[0]] = string(payload[1 : end+1])
+		payload = payload[end+2:]
+	}
+
+	return fmt.Errorf("server error %s %s: %s", fields['S'], fields['C'], fields['M'])
+}
+
+// startTLS asks the server for TLS and completes the handshake. It needs to be called before startup.
+func (c *conn) startTLS(config *tls.Config) (tls.ConnectionState, error) {
+	msg := &message{}
+	msg.writeInt32(sslRequestCode)
+
+	if err := c.send(0, msg); err != nil {
+		return tls.ConnectionState{}, err
+	}
+
+	response, err := c.reader.ReadByte()
+	if err != nil {
+		return tls.ConnectionState{}, fmt.Errorf("tls request: %w", err)
+	}
+
+	if response != 'S' {
+		return tls.ConnectionState{}, fmt.Errorf("tls request: server declined")
+	}
+
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return tls.ConnectionState{}, fmt.Errorf("tls: %w", err)
+	}
+
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+
+	return tlsConn.ConnectionState(), nil
+}
+
+// sendPassword answers a password request.
+func (c *conn) sendPassword(password string) error {
+	msg := &message{}
+	msg.writeCString(password)
+
+	return c.send('p', msg)
+}
+
+// md5Password returns the response to a md5 password request.
+func md5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))                               //nolint:gosec // Required by the protocol.
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...)) //nolint:gosec // Required by the protocol.
+
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// authenticate answers a single authentication request. It returns true once authentication succeeded. Once a SCRAM
+// exchange started, the server needs to prove that it knows the password before it may accept the client.
+func (c *conn) authenticate(payload []byte, user, password string, sasl **scram) (bool, error) {
+	if len(payload) < 4 {
+		return false, fmt.Errorf("authentication request too short")
+	}
+
+	data := payload[4:]
+
+	switch code := binary.BigEndian.Uint32(payload); code {
+	case authOK:
+		if *sasl != nil && !(*sasl).verified {
+			return false, fmt.Errorf("sasl: accepted without server signature")
+		}
+
+		return true, nil
+	case authCleartextPassword:
+		return false, c.sendPassword(password)
+	case authMD5Password:
+		if len(data) != 4 {
+			return false, fmt.Errorf("md5: invalid salt")
+		}
+
+		return false, c.sendPassword(md5Password(user, password, data))
+	case authSASL:
+		if !strings.Contains(string(data), scramMechanism+"\x00") {
+			return false, fmt.Errorf("sasl: %s not offered", scramMechanism)
+		}
+
+		*sasl = newSCRAM(password)
+		first := (*sasl).clientFirst()
+
+		msg := &message{}
+		msg.writeCString(scramMechanism)
+		msg.writeInt32(int32(len(first)))
+		msg.WriteString(first)
+
+		return false, c.send('p', msg)
+	case authSASLContinue:
+		if *sasl == nil {
+			return false, fmt.Errorf("sasl: unexpected continue")
+		}
+
+		final, err := (*sasl).clientFinal(string(data))
+		if err != nil {
+			return false, err
+		}
+
+		msg := &message{}
+		msg.WriteString(final)
+
+		return false, c.send('p', msg)
+	case authSASLFinal:
+		if *sasl == nil {
+			return false, fmt.Errorf("sasl: unexpected final")
+		}
+
+		return false, (*sasl).verifyServerFinal(string(data))
+	default:
+		return false, fmt.Errorf("unsupported authentication method %d", code)
+	}
+}
+
+// startup sends the startup message, authenticates and waits until the server is ready for queries.
+func (c *conn) startup(user, password, database string) error {
+	msg := &message{}
+	msg.writeInt32(protocolVersion)
+
+	for _, parameter := range []string{"user", user, "database", database, "application_name", "healthcheck"} {
+		msg.writeCString(parameter)
+	}
+
+	msg.WriteByte(0)
+
+	if err := c.send(0, msg); err != nil {
+		return err
+	}
+
+	var sasl *scram
+
+	authenticated := false
+
+	for {
+		kind, payload, err := c.receive()
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case 'R':
+			if authenticated, err = c.authenticate(payload, user, password, &sasl); err != nil {
+				return fmt.Errorf("authenticate: %w", err)
+			}
+		case 'Z':
+			if !authenticated {
+				return fmt.Errorf("ready before authentication")
+			}
+
+			return nil
+		}
+	}
+}
+
+// parseDataRow returns the column values of a data row. NULL is returned as empty string.
+func parseDataRow(payload []byte) ([]string, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("data row too short")
+	}
+
+	count := int(binary.BigEndian.Uint16(payload))
+	payload = payload[2:]
+	values := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+		if len(payload) < 4 {
+			return nil, fmt.Errorf("data row truncated")
+		}
+
+		length := int32(binary.BigEndian.Uint32(payload))
+		payload = payload[4:]
+
+		if length < 0 {
+			values = append(values, "")
+
+			continue
+		}
+
+		if int(length) > len(payload) {
+			return nil, fmt.Errorf("data row truncated")
+		}
+
+		values = append(values, string(payload[:length]))
+		payload = payload[length:]
+	}
+
+	return values, nil
+}
+
+// query runs a simple query and returns the rows of its result in text format.
+func (c *conn) query(sql string) ([][]string, error) {
+	msg := &message{}
+	msg.writeCString(sql)
+
+	if err := c.send('Q', msg); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+
+	for {
+		kind, payload, err := c.receive()
+		if err != nil {
+			// The server still sends ReadyForQuery after an error, the connection is not used again though.
+			return nil, fmt.Errorf("query: %w", err)
+		}
+
+		switch kind {
+		case 'D':
+			row, err := parseDataRow(payload)
+			if err != nil {
+				return nil, fmt.Errorf("query: %w", err)
+			}
+
+			rows = append(rows, row)
+		case 'Z':
+			return rows, nil
+		}
+	}
+}
+
+// terminate ends the session.
+func (c *conn) terminate() error {
+	return c.send('X', &message{})
+}
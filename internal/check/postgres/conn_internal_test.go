@@ -0,0 +1,305 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// backend is the server side of a connection in tests.
+type backend struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// pipe returns a client connection and the backend serving it with serve. The backend connection is closed when
+// serve returns, so the client does not block on a failed test. The test waits for serve to return.
+func pipe(t *testing.T, serve func(*backend)) *conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		defer server.Close()
+
+		serve(&backend{t: t, conn: server, reader: bufio.NewReader(server)})
+	}()
+
+	return newConn(client)
+}
+
+// startup reads the startup message and returns its parameters.
+func (b *backend) startup() map[string]string {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(b.reader, length); err != nil {
+		b.t.Errorf("read startup: %v", err)
+
+		return nil
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(length)-4)
+	if _, err := io.ReadFull(b.reader, payload); err != nil {
+		b.t.Errorf("read startup: %v", err)
+
+		return nil
+	}
+
+	if version := binary.BigEndian.Uint32(payload); version != protocolVersion {
+		b.t.Errorf("protocol version = %d", version)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(payload[4:]), "\x00\x00"), "\x00")
+	parameters := map[string]string{}
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		parameters[fields[i]] = fields[i+1]
+	}
+
+	return parameters
+}
+
+// receive reads a message from the client.
+func (b *backend) receive() (byte, []byte) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(b.reader, header); err != nil {
+		b.t.Errorf("receive: %v", err)
+
+		return 0, nil
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	if _, err := io.ReadFull(b.reader, payload); err != nil {
+		b.t.Errorf("receive: %v", err)
+	}
+
+	return header[0], payload
+}
+
+// send writes a message with the concatenated parts as payload.
+func (b *backend) send(kind byte, parts ...[]byte) {
+	payload := bytes.Join(parts, nil)
+	header := []byte{kind, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
+
+	if _, err := b.conn.Write(append(header, payload...)); err != nil {
+		b.t.Errorf("send: %v", err)
+	}
+}
+
+func int32Bytes(value int) []byte {
+	encoded := make([]byte, 4)
+	binary.BigEndian.PutUint32(encoded, uint32(value))
+
+	return encoded
+}
+
+func cString(value string) []byte {
+	return append([]byte(value), 0)
+}
+
+// ready sends authentication ok and ready for query.
+func (b *backend) ready() {
+	b.send('R', int32Bytes(authOK))
+	b.send('S', cString("server_version"), cString("15.0"))
+	b.send('Z', []byte("I"))
+}
+
+// rows answers a query with the given rows.
+func (b *backend) rows(rows ...[]string) {
+	b.send('T', []byte{0, 0})
+
+	for _, row := range rows {
+		parts := [][]byte{{0, byte(len(row))}}
+
+		for _, value := range row {
+			if value == "NULL" {
+				parts = append(parts, int32Bytes(-1))
+
+				continue
+			}
+
+			parts = append(parts, int32Bytes(len(value)), []byte(value))
+		}
+
+		b.send('D', parts...)
+	}
+
+	b.send('C', cString("SELECT"))
+	b.send('Z', []byte("I"))
+}
+
+func TestStartup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		serve   func(*backend)
+		problem string
+	}{
+		{"trust", func(b *backend) { b.ready() }, ""},
+		{"cleartext", func(b *backend) {
+			b.send('R', int32Bytes(authCleartextPassword))
+
+			if kind, payload := b.receive(); kind != 'p' || string(payload) != "secret\x00" {
+				b.t.Errorf("password message = %c %q", kind, payload)
+			}
+
+			b.ready()
+		}, ""},
+		{"md5", func(b *backend) {
+			b.send('R', int32Bytes(authMD5Password), []byte{1, 2, 3, 4})
+
+			if _, payload := b.receive(); string(payload) != "md598a0412b9c31436fc53776e863350083\x00" {
+				b.t.Errorf("md5 password = %q", payload)
+			}
+
+			b.ready()
+		}, ""},
+		{"scram server signature", func(b *backend) {
+			b.send('R', int32Bytes(authSASL), cString("SCRAM-SHA-256-PLUS"), cString(scramMechanism), []byte{0})
+
+			_, payload := b.receive()
+			_, first, _ := strings.Cut(string(payload), "n,,n=,r=")
+			b.send('R', int32Bytes(authSASLContinue), []byte("r="+first+"server,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+
+			if _, payload := b.receive(); !strings.HasPrefix(string(payload), "c=biws,r="+first+"server,p=") {
+				b.t.Errorf("client final = %q", payload)
+			}
+
+			b.send('R', int32Bytes(authSASLFinal), []byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+		}, "invalid server signature"},
+		{"scram without server signature", func(b *backend) {
+			b.send('R', int32Bytes(authSASL), cString(scramMechanism), []byte{0})
+
+			_, payload := b.receive()
+			_, first, _ := strings.Cut(string(payload), "n,,n=,r=")
+			b.send('R', int32Bytes(authSASLContinue), []byte("r="+first+"server,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+			b.receive()
+			b.send('R', int32Bytes(authOK))
+		}, "accepted without server signature"},
+		{"scram not offered", func(b *backend) {
+			b.send('R', int32Bytes(authSASL), cString("SCRAM-SHA-256-PLUS"), []byte{0})
+		}, "not offered"},
+		{"unsupported", func(b *backend) { b.send('R', int32Bytes(7)) }, "unsupported authentication method 7"},
+		{"ready early", func(b *backend) { b.send('Z', []byte("I")) }, "ready before authentication"},
+		{"error", func(b *backend) {
+			b.send('E', cString("SFATAL"), cString("C28P01"), cString("Mpassword authentication failed"), []byte{0})
+		}, "server error FATAL 28P01: password authentication failed"},
+		{"closed", func(b *backend) {}, "EOF"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := pipe(t, func(b *backend) {
+				parameters := b.startup()
+				if parameters["user"] != "alice" || parameters["database"] != "app" {
+					b.t.Errorf("startup parameters = %v", parameters)
+				}
+
+				test.serve(b)
+			})
+
+			err := conn.startup("alice", "secret", "app")
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("startup() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("startup() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	conn := pipe(t, func(b *backend) {
+		if kind, payload := b.receive(); kind != 'Q' || string(payload) != "SELECT 1\x00" {
+			b.t.Errorf("query message = %c %q", kind, payload)
+		}
+
+		b.rows([]string{"1", "NULL", ""}, []string{"2", "b", "c"})
+
+		b.receive()
+		b.send('E', cString("SERROR"), cString("C42P01"), cString("Mrelation does not exist"), []byte{0})
+	})
+
+	rows, err := conn.query("SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || strings.Join(rows[0], ",") != "1,," || strings.Join(rows[1], ",") != "2,b,c" {
+		t.Errorf("query() = %q", rows)
+	}
+
+	if _, err := conn.query("SELECT * FROM missing"); err == nil || !strings.Contains(err.Error(), "42P01") {
+		t.Errorf("query() = %v, want server error", err)
+	}
+}
+
+func TestParseDataRow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []string
+	}{
+		{"empty", []byte{0, 0}, []string{}},
+		{"values", []byte{0, 2, 0, 0, 0, 1, 'a', 0, 0, 0, 0}, []string{"a", ""}},
+		{"null", []byte{0, 1, 0xff, 0xff, 0xff, 0xff}, []string{""}},
+		{"short", []byte{0}, nil},
+		{"missing column", []byte{0, 2, 0, 0, 0, 1, 'a'}, nil},
+		{"truncated value", []byte{0, 1, 0, 0, 0, 5, 'a'}, nil},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			values, err := parseDataRow(test.payload)
+
+			switch {
+			case test.want == nil && err == nil:
+				t.Errorf("parseDataRow() = %q, want error", values)
+			case test.want != nil && err != nil:
+				t.Errorf("parseDataRow() = %v", err)
+			case strings.Join(values, ",") != strings.Join(test.want, ",") || len(values) != len(test.want):
+				t.Errorf("parseDataRow() = %q, want %q", values, test.want)
+			}
+		})
+	}
+}
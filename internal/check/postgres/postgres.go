@@ -0,0 +1,300 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package postgres contains a health check for PostgreSQL servers.
+package postgres
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"eqrx.net/service"
+	"github.com/go-logr/logr"
+)
+
+// defaultPort is the port PostgreSQL listens on if nothing else is configured.
+const defaultPort = "5432"
+
+const (
+	// connectionsQuery returns the connection limit, the number of client connections and if the server is a
+	// standby. Background processes like autovacuum do not count against the limit.
+	connectionsQuery = "SELECT current_setting('max_connections'), " +
+		"(SELECT count(*) FROM pg_stat_activity WHERE backend_type = 'client backend'), pg_is_in_recovery()"
+	// standbyLagQuery returns the status of the WAL receiver and the seconds since the last replayed transaction,
+	// or zero if everything received has been replayed.
+	standbyLagQuery = "SELECT COALESCE((SELECT status FROM pg_stat_wal_receiver), 'stopped'), " +
+		"CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 " +
+		"ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END"
+	// replicasQuery returns the name and replay lag in seconds of all replicas connected to a primary.
+	replicasQuery = "SELECT application_name, COALESCE(EXTRACT(EPOCH FROM replay_lag), 0) FROM pg_stat_replication"
+)
+
+// Credentials contains the login used to authenticate with the server.
+type Credentials struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// Check connects to all addresses of a PostgreSQL server, logs in and verifies the connection usage and
+// replication. Host may be the directory of the server's unix socket. MaxConnectionsUsed is the maximum ratio of
+// max_connections in use. MaxReplicationLag applies to a standby itself and to the replicas of a primary, which also
+// needs to have at least MinReplicas of them. Reading the replication state requires the pg_monitor role.
+// Zero limits are not checked. AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool                `yaml:"ipv4"`
+	AddressFamilies    string              `yaml:"addressFamilies"`
+	RequireAllFamilies bool                `yaml:"requireAllFamilies"`
+	Host               string              `yaml:"host"`
+	Port               string              `yaml:"port"`
+	TLS                bool                `yaml:"tls"`
+	Certificates       tlscheck.Inspection `yaml:"certificates"`
+	CredsName          string              `yaml:"credsName"`
+	Database           string              `yaml:"database"`
+	MaxConnectionsUsed float64             `yaml:"maxConnectionsUsed"`
+	MaxReplicationLag  time.Duration       `yaml:"maxReplicationLag"`
+	MinReplicas        int                 `yaml:"minReplicas"`
+	creds              Credentials         `yaml:"-"`
+	families           []netcheck.Family   `yaml:"-"`
+	targetRRType       uint16              `yaml:"-"`
+	network            string              `yaml:"-"`
+}
+
+// Setup prepares often used values and loads the credentials.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Host == "" {
+		return fmt.Errorf("no host given")
+	}
+
+	if c.Port == "" {
+		c.Port = defaultPort
+	}
+
+	if c.Database == "" {
+		c.Database = "postgres"
+	}
+
+	if err := service.UnmarshalYAMLCreds(c.CredsName, &c.creds); err != nil {
+		return fmt.Errorf("credentials: %w", err)
+	}
+
+	return nil
+}
+
+// Check resolves the host for each address family and connects to all its addresses, or to the unix socket if the
+// host is a path.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if strings.HasPrefix(c.Host, "/") {
+		socket := path.Join(c.Host, ".s.PGSQL."+c.Port)
+
+		if err := c.connect(ctx, "unix", socket, rep); err != nil {
+			return fmt.Errorf("postgres check: connect %s: %w", socket, err)
+		}
+
+		return nil
+	}
+
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
+		})
+	if err != nil {
+		return fmt.Errorf("postgres check: %w", err)
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// checkServers resolves the host and connects to all its addresses.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	addrs, err := netcheck.Resolve(ctx, c.Host, c.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", c.Host, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", c.Host, netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		hostPort := net.JoinHostPort(addrs[i].String(), c.Port)
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.connect(ctx, c.network, hostPort, rep.Sub(hostPort)); err != nil {
+				return fmt.Errorf("connect %s: %w", hostPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+func (c Check) connect(ctx context.Context, network, addr string, rep *report.Report) error {
+	return netcheck.Dial(ctx, network, addr, func(netConn net.Conn) error {
+		conn := newConn(netConn)
+
+		if c.TLS {
+			state, err := conn.startTLS(&tls.Config{ServerName: c.Host, MinVersion: tls.VersionTLS12})
+			if err != nil {
+				return err
+			}
+
+			c.Certificates.Inspect(state, rep)
+		}
+
+		if err := conn.startup(c.creds.User, c.creds.Password, c.Database); err != nil {
+			return err
+		}
+
+		if err := c.verify(conn, rep); err != nil {
+			return err
+		}
+
+		return conn.terminate()
+	})
+}
+
+// verify checks the connection usage and replication.
+func (c Check) verify(conn *conn, rep *report.Report) error {
+	rows, err := conn.query(connectionsQuery)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) != 1 || len(rows[0]) != 3 {
+		return fmt.Errorf("connections: unexpected result")
+	}
+
+	maxConnections, maxErr := strconv.ParseFloat(rows[0][0], 64)
+	connections, countErr := strconv.ParseFloat(rows[0][1], 64)
+
+	if maxErr != nil || countErr != nil || maxConnections == 0 {
+		return fmt.Errorf("connections: unexpected result %v", rows[0])
+	}
+
+	rep.Metric("connections", connections, "")
+	rep.Metric("connections_used", connections/maxConnections, "")
+
+	if c.MaxConnectionsUsed != 0 && connections/maxConnections > c.MaxConnectionsUsed {
+		return fmt.Errorf("%.0f of %.0f connections used", connections, maxConnections)
+	}
+
+	if rows[0][2] == "t" {
+		return c.verifyStandby(conn, rep)
+	}
+
+	return c.verifyPrimary(conn, rep)
+}
+
+// verifyStandby checks that a standby streams from its primary and its replication lag. A standby without WAL
+// receiver has replayed everything it received and would show no lag otherwise.
+func (c Check) verifyStandby(conn *conn, rep *report.Report) error {
+	rows, err := conn.query(standbyLagQuery)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) != 1 || len(rows[0]) != 2 {
+		return fmt.Errorf("standby lag: unexpected result")
+	}
+
+	rep.Note("standby")
+
+	if rows[0][0] != "streaming" {
+		return fmt.Errorf("wal receiver %s", rows[0][0])
+	}
+
+	seconds, err := strconv.ParseFloat(rows[0][1], 64)
+	if err != nil {
+		return fmt.Errorf("standby lag: %w", err)
+	}
+
+	lag := time.Duration(seconds * float64(time.Second))
+
+	rep.Metric("replication_lag", lag.Seconds(), "s")
+
+	if c.MaxReplicationLag != 0 && lag > c.MaxReplicationLag {
+		return fmt.Errorf("replication lag %s", lag.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// verifyPrimary checks the number and replication lag of the replicas of a primary.
+func (c Check) verifyPrimary(conn *conn, rep *report.Report) error {
+	if c.MaxReplicationLag == 0 && c.MinReplicas == 0 {
+		return nil
+	}
+
+	rows, err := conn.query(replicasQuery)
+	if err != nil {
+		return err
+	}
+
+	rep.Metric("replicas", float64(len(rows)), "")
+
+	if len(rows) < c.MinReplicas {
+		return fmt.Errorf("%d replicas connected, %d required", len(rows), c.MinReplicas)
+	}
+
+	for _, row := range rows {
+		if len(row) != 2 {
+			return fmt.Errorf("replicas: unexpected result")
+		}
+
+		seconds, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			return fmt.Errorf("replica %s: lag: %w", row[0], err)
+		}
+
+		lag := time.Duration(seconds * float64(time.Second))
+
+		rep.Sub("replica "+row[0]).Metric("replication_lag", lag.Seconds(), "s")
+
+		if c.MaxReplicationLag != 0 && lag > c.MaxReplicationLag {
+			return fmt.Errorf("replica %s: replication lag %s", row[0], lag.Round(time.Millisecond))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package postgres
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// answer serves the queries of verify with the given results.
+func answer(results map[string][][]string) func(*backend) {
+	return func(b *backend) {
+		for {
+			kind, payload := b.receive()
+			if kind != 'Q' {
+				return
+			}
+
+			rows, ok := results[strings.TrimSuffix(string(payload), "\x00")]
+			if !ok {
+				b.t.Errorf("unexpected query %q", payload)
+
+				return
+			}
+
+			b.rows(rows...)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		check   Check
+		results map[string][][]string
+		problem string
+	}{
+		{"primary", Check{MaxConnectionsUsed: 0.5, MinReplicas: 1, MaxReplicationLag: time.Second},
+			map[string][][]string{
+				connectionsQuery: {{"100", "20", "f"}},
+				replicasQuery:    {{"replica1", "0.25"}},
+			}, ""},
+		{"connections", Check{MaxConnectionsUsed: 0.5},
+			map[string][][]string{connectionsQuery: {{"100", "60", "f"}}}, "60 of 100 connections used"},
+		{"missing replica", Check{MinReplicas: 2},
+			map[string][][]string{
+				connectionsQuery: {{"100", "20", "f"}},
+				replicasQuery:    {{"replica1", "0"}},
+			}, "1 replicas connected, 2 required"},
+		{"lagging replica", Check{MaxReplicationLag: time.Second},
+			map[string][][]string{
+				connectionsQuery: {{"100", "20", "f"}},
+				replicasQuery:    {{"replica1", "2.5"}},
+			}, "replica replica1: replication lag 2.5s"},
+		{"standby", Check{MaxReplicationLag: time.Second},
+			map[string][][]string{
+				connectionsQuery: {{"100", "20", "t"}},
+				standbyLagQuery:  {{"streaming", "0.5"}},
+			}, ""},
+		{"disconnected standby", Check{MaxReplicationLag: time.Second},
+			map[string][][]string{
+				connectionsQuery: {{"100", "20", "t"}},
+				standbyLagQuery:  {{"stopped", "0"}},
+			}, "wal receiver stopped"},
+		{"lagging standby", Check{MaxReplicationLag: time.Second},
+			map[string][][]string{
+				connectionsQuery: {{"100", "20", "t"}},
+				standbyLagQuery:  {{"streaming", "3"}},
+			}, "replication lag 3s"},
+		{"unexpected result", Check{},
+			map[string][][]string{connectionsQuery: {{"100", "NULL", "f"}}}, "unexpected result"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := pipe(t, answer(test.results))
+			rep := &report.Report{}
+
+			err := test.check.verify(conn, rep)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("verify() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("verify() = %v, want %q", err, test.problem)
+			}
+
+			if err := conn.terminate(); err != nil && test.problem == "" {
+				t.Errorf("terminate() = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// scramMechanism is the only SASL mechanism supported by PostgreSQL without channel binding.
+	scramMechanism = "SCRAM-SHA-256"
+	// scramIterationLimit is the maximum iteration count accepted from the server.
+	scramIterationLimit = 1 << 20
+)
+
+// scram is the client side of a SCRAM-SHA-256 exchange as described in RFC 5802 and RFC 7677. The user name is
+// left empty since PostgreSQL takes it from the startup message. Passwords are not normalized with SASLprep.
+type scram struct {
+	password        string
+	clientNonce     string
+	clientFirstBare string
+	authMessage     string
+	saltedPassword  []byte
+	verified        bool
+}
+
+func newSCRAM(password string) *scram {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("read random: %v", err))
+	}
+
+	clientNonce := base64.StdEncoding.EncodeToString(nonce)
+
+	return &scram{password: password, clientNonce: clientNonce, clientFirstBare: "n=,r=" + clientNonce}
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// clientFirst returns the first message of the client.
+func (s *scram) clientFirst() string {
+	return "n,," + s.clientFirstBare
+}
+
+// clientFinal processes the first message of the server and returns the final message of the client.
+func (s *scram) clientFinal(serverFirst string) (string, error) {
+	attributes := map[string]string{}
+
+	for _, attribute := range strings.Split(serverFirst, ",") {
+		if len(attribute) > 2 && attribute[1] == '=' {
+			attributes[attribute[:1]] = attribute[2:]
+		}
+	}
+
+	nonce := attributes["r"]
+	if !strings.HasPrefix(nonce, s.clientNonce) || len(nonce) == len(s.clientNonce) {
+		return "", fmt.Errorf("scram: server nonce does not extend client nonce")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil {
+		return "", fmt.Errorf("scram: salt: %w", err)
+	}
+
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil || iterations < 1 || iterations > scramIterationLimit {
+		return "", fmt.Errorf("scram: invalid iteration count %q", attributes["i"])
+	}
+
+	s.saltedPassword = pbkdf2.Key([]byte(s.password), salt, iterations, sha256.Size, sha256.New)
+
+	withoutProof := "c=biws,r=" + nonce
+	s.authMessage = s.clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	clientKey := hmacSHA256(s.saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	signature := hmacSHA256(storedKey[:], s.authMessage)
+
+	for i := range clientKey {
+		clientKey[i] ^= signature[i]
+	}
+
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(clientKey), nil
+}
+
+// verifyServerFinal checks that the server knows the password too and marks the exchange as verified.
+func (s *scram) verifyServerFinal(serverFinal string) error {
+	if !strings.HasPrefix(serverFinal, "v=") {
+		return fmt.Errorf("scram: no server signature")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(serverFinal, "v="))
+	if err != nil {
+		return fmt.Errorf("scram: server signature: %w", err)
+	}
+
+	serverKey := hmacSHA256(s.saltedPassword, "Server Key")
+
+	if !hmac.Equal(signature, hmacSHA256(serverKey, s.authMessage)) {
+		return fmt.Errorf("scram: invalid server signature")
+	}
+
+	s.verified = true
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+// rfc7677 returns the client of the example exchange in RFC 7677, which names the user in the first message.
+func rfc7677() *scram {
+	return &scram{
+		password:        "pencil",
+		clientNonce:     "rOprNGfwEbeRWgbNEkqO",
+		clientFirstBare: "n=user,r=rOprNGfwEbeRWgbNEkqO",
+	}
+}
+
+const rfc7677ServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+
+func TestSCRAM(t *testing.T) {
+	t.Parallel()
+
+	client := rfc7677()
+
+	final, err := client.clientFinal(rfc7677ServerFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0," +
+		"p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if final != want {
+		t.Errorf("clientFinal() = %s, want %s", final, want)
+	}
+
+	if client.verified {
+		t.Error("exchange verified before server final")
+	}
+
+	if err := client.verifyServerFinal("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil || !client.verified {
+		t.Errorf("verifyServerFinal() = %v", err)
+	}
+
+	for _, serverFinal := range []string{"v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=", "e=invalid-proof", "v=!"} {
+		if err := client.verifyServerFinal(serverFinal); err == nil {
+			t.Errorf("verifyServerFinal(%q) accepted", serverFinal)
+		}
+	}
+}
+
+func TestSCRAMInvalidServerFirst(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		serverFirst string
+		problem     string
+	}{
+		{"foreign nonce", "r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", "nonce"},
+		{"same nonce", "r=rOprNGfwEbeRWgbNEkqO,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", "nonce"},
+		{"bad salt", "r=rOprNGfwEbeRWgbNEkqOx,s=!,i=4096", "salt"},
+		{"no iterations", "r=rOprNGfwEbeRWgbNEkqOx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0", "iteration"},
+		{"too many iterations", "r=rOprNGfwEbeRWgbNEkqOx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=1048577", "iteration"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := rfc7677().clientFinal(test.serverFirst); err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Errorf("clientFinal() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
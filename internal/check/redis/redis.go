@@ -0,0 +1,346 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package redis contains a health check for Redis servers.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"eqrx.net/service"
+	"github.com/go-logr/logr"
+)
+
+// defaultPort is the port Redis listens on if nothing else is configured.
+const defaultPort = "6379"
+
+// Credentials contains the login used to authenticate with the server. User may be empty for servers without ACLs.
+type Credentials struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// Check connects to all addresses of a Redis server, optionally logs in, pings it and verifies the client usage and
+// replication. Host may be the path of the server's unix socket. MaxConnectionsUsed is the maximum ratio of
+// maxclients in use. MaxReplicationLag applies to the link of a replica to its master and to the replicas of a
+// master, which also needs to have at least MinReplicas of them. Zero limits are not checked.
+// AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool                `yaml:"ipv4"`
+	AddressFamilies    string              `yaml:"addressFamilies"`
+	RequireAllFamilies bool                `yaml:"requireAllFamilies"`
+	Host               string              `yaml:"host"`
+	Port               string              `yaml:"port"`
+	TLS                bool                `yaml:"tls"`
+	Certificates       tlscheck.Inspection `yaml:"certificates"`
+	CredsName          string              `yaml:"credsName"`
+	MaxConnectionsUsed float64             `yaml:"maxConnectionsUsed"`
+	MaxReplicationLag  time.Duration       `yaml:"maxReplicationLag"`
+	MinReplicas        int                 `yaml:"minReplicas"`
+	creds              *Credentials        `yaml:"-"`
+	families           []netcheck.Family   `yaml:"-"`
+	targetRRType       uint16              `yaml:"-"`
+	network            string              `yaml:"-"`
+}
+
+// Setup prepares often used values and loads the credentials if configured.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Host == "" {
+		return fmt.Errorf("no host given")
+	}
+
+	if c.Port == "" {
+		c.Port = defaultPort
+	}
+
+	if c.CredsName != "" {
+		c.creds = &Credentials{}
+
+		if err := service.UnmarshalYAMLCreds(c.CredsName, c.creds); err != nil {
+			return fmt.Errorf("credentials: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Check resolves the host for each address family and connects to all its addresses, or to the unix socket if the
+// host is a path.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if strings.HasPrefix(c.Host, "/") {
+		if err := c.connect(ctx, "unix", c.Host, rep); err != nil {
+			return fmt.Errorf("redis check: connect %s: %w", c.Host, err)
+		}
+
+		return nil
+	}
+
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
+		})
+	if err != nil {
+		return fmt.Errorf("redis check: %w", err)
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// checkServers resolves the host and connects to all its addresses.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	addrs, err := netcheck.Resolve(ctx, c.Host, c.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", c.Host, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", c.Host, netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		hostPort := net.JoinHostPort(addrs[i].String(), c.Port)
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.connect(ctx, c.network, hostPort, rep.Sub(hostPort)); err != nil {
+				return fmt.Errorf("connect %s: %w", hostPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+func (c Check) connect(ctx context.Context, network, addr string, rep *report.Report) error {
+	return netcheck.Dial(ctx, network, addr, func(conn net.Conn) error {
+		if c.TLS {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: c.Host, MinVersion: tls.VersionTLS12})
+			if err := tlsConn.Handshake(); err != nil {
+				return fmt.Errorf("tls: %w", err)
+			}
+
+			c.Certificates.Inspect(tlsConn.ConnectionState(), rep)
+
+			conn = tlsConn
+		}
+
+		client := newClient(conn)
+
+		if c.creds != nil {
+			args := []string{"AUTH", c.creds.Password}
+			if c.creds.User != "" {
+				args = []string{"AUTH", c.creds.User, c.creds.Password}
+			}
+
+			if _, err := client.command(args...); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+
+		reply, err := client.command("PING")
+		if err != nil {
+			return err
+		}
+
+		if reply != "PONG" {
+			return fmt.Errorf("PING: unexpected reply %v", reply)
+		}
+
+		rep.Metric("ping_time", time.Since(start).Seconds(), "s")
+
+		if err := c.verifyClients(client, rep); err != nil {
+			return err
+		}
+
+		if err := c.verifyReplication(client, rep); err != nil {
+			return err
+		}
+
+		_, err = client.command("QUIT")
+
+		return err
+	})
+}
+
+// maxClients returns the client limit. It is part of INFO since Redis 7 and queried from the configuration before.
+func maxClients(client *client, info map[string]string) (float64, error) {
+	if value, ok := info["maxclients"]; ok {
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("maxclients: %w", err)
+		}
+
+		return limit, nil
+	}
+
+	reply, err := client.command("CONFIG", "GET", "maxclients")
+	if err != nil {
+		return 0, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, fmt.Errorf("CONFIG GET: unexpected reply %v", reply)
+	}
+
+	value, _ := values[1].(string)
+
+	limit, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("maxclients: %w", err)
+	}
+
+	return limit, nil
+}
+
+// verifyClients checks the number of connected clients against the limit.
+func (c Check) verifyClients(client *client, rep *report.Report) error {
+	info, err := client.info("clients")
+	if err != nil {
+		return err
+	}
+
+	clients, err := strconv.ParseFloat(info["connected_clients"], 64)
+	if err != nil {
+		return fmt.Errorf("connected_clients: %w", err)
+	}
+
+	rep.Metric("connections", clients, "")
+
+	if c.MaxConnectionsUsed == 0 {
+		return nil
+	}
+
+	limit, err := maxClients(client, info)
+	if err != nil {
+		return err
+	}
+
+	rep.Metric("connections_used", clients/limit, "")
+
+	if clients/limit > c.MaxConnectionsUsed {
+		return fmt.Errorf("%.0f of %.0f clients connected", clients, limit)
+	}
+
+	return nil
+}
+
+// verifyReplication checks the link of a replica or the replicas of a master.
+func (c Check) verifyReplication(client *client, rep *report.Report) error {
+	info, err := client.info("replication")
+	if err != nil {
+		return err
+	}
+
+	rep.Note("role %s", info["role"])
+
+	if info["role"] == "slave" {
+		if info["master_link_status"] != "up" {
+			return fmt.Errorf("link to master %s", info["master_link_status"])
+		}
+
+		seconds, err := strconv.Atoi(info["master_last_io_seconds_ago"])
+		if err != nil {
+			return fmt.Errorf("master_last_io_seconds_ago: %w", err)
+		}
+
+		lag := time.Duration(seconds) * time.Second
+
+		rep.Metric("replication_lag", lag.Seconds(), "s")
+
+		if c.MaxReplicationLag != 0 && lag > c.MaxReplicationLag {
+			return fmt.Errorf("last contact with master %s ago", lag)
+		}
+
+		return nil
+	}
+
+	return c.verifyReplicas(info, rep)
+}
+
+// verifyReplicas checks the replicas listed in the replication info of a master.
+func (c Check) verifyReplicas(info map[string]string, rep *report.Report) error {
+	replicas, err := strconv.Atoi(info["connected_slaves"])
+	if err != nil {
+		return fmt.Errorf("connected_slaves: %w", err)
+	}
+
+	rep.Metric("replicas", float64(replicas), "")
+
+	if replicas < c.MinReplicas {
+		return fmt.Errorf("%d replicas connected, %d required", replicas, c.MinReplicas)
+	}
+
+	for i := 0; i < replicas; i++ {
+		fields := map[string]string{}
+
+		for _, field := range strings.Split(info["slave"+strconv.Itoa(i)], ",") {
+			if name, value, found := strings.Cut(field, "="); found {
+				fields[name] = value
+			}
+		}
+
+		name := net.JoinHostPort(fields["ip"], fields["port"])
+
+		if fields["state"] != "online" {
+			return fmt.Errorf("replica %s: state %s", name, fields["state"])
+		}
+
+		seconds, err := strconv.Atoi(fields["lag"])
+		if err != nil {
+			return fmt.Errorf("replica %s: lag: %w", name, err)
+		}
+
+		lag := time.Duration(seconds) * time.Second
+
+		rep.Sub("replica "+name).Metric("replication_lag", lag.Seconds(), "s")
+
+		if c.MaxReplicationLag != 0 && lag > c.MaxReplicationLag {
+			return fmt.Errorf("replica %s: replication lag %s", name, lag)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package redis
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// bulk encodes content as bulk string reply.
+func bulk(content string) string {
+	return "$" + strconv.Itoa(len(content)) + "\r\n" + content + "\r\n"
+}
+
+// listen serves the INFO sections in infos on a unix socket and returns its path. AUTH succeeds for the password
+// secret.
+func listen(t *testing.T, infos map[string]string) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "redis.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serve(t, conn, func(args []string) string {
+				switch args[0] {
+				case "AUTH":
+					if args[len(args)-1] != "secret" {
+						return "-WRONGPASS invalid username-password pair\r\n"
+					}
+
+					return "+OK\r\n"
+				case "PING":
+					return "+PONG\r\n"
+				case "INFO":
+					return bulk(infos[args[1]])
+				case "CONFIG":
+					return "*2\r\n" + bulk("maxclients") + bulk("10")
+				case "QUIT":
+					return "+OK\r\n"
+				default:
+					return "-ERR unknown command\r\n"
+				}
+			})
+		}
+	}()
+
+	return socket
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	master := "role:master\r\nconnected_slaves:2\r\n" +
+		"slave0:ip=10.0.0.1,port=6379,state=online,offset=100,lag=0\r\n" +
+		"slave1:ip=10.0.0.2,port=6379,state=online,offset=90,lag=3\r\n"
+
+	tests := []struct {
+		name    string
+		check   Check
+		infos   map[string]string
+		problem string
+	}{
+		{"master", Check{MinReplicas: 2, MaxReplicationLag: 5 * time.Second, MaxConnectionsUsed: 0.5},
+			map[string]string{"clients": "connected_clients:3\r\nmaxclients:100\r\n", "replication": master}, ""},
+		{"config maxclients", Check{MaxConnectionsUsed: 0.5},
+			map[string]string{"clients": "connected_clients:6\r\n", "replication": master}, "6 of 10 clients connected"},
+		{"missing replica", Check{MinReplicas: 3},
+			map[string]string{"clients": "connected_clients:3\r\n", "replication": master}, "2 replicas connected, 3 required"},
+		{"lagging replica", Check{MaxReplicationLag: 2 * time.Second},
+			map[string]string{"clients": "connected_clients:3\r\n", "replication": master},
+			"replica 10.0.0.2:6379: replication lag 3s"},
+		{"replica", Check{MaxReplicationLag: 5 * time.Second}, map[string]string{
+			"clients":     "connected_clients:3\r\n",
+			"replication": "role:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:1\r\n",
+		}, ""},
+		{"replica down", Check{}, map[string]string{
+			"clients":     "connected_clients:3\r\n",
+			"replication": "role:slave\r\nmaster_link_status:down\r\nmaster_last_io_seconds_ago:-1\r\n",
+		}, "link to master down"},
+		{"wrong password", Check{creds: &Credentials{User: "alice", Password: "wrong"}},
+			map[string]string{}, "AUTH: server error: WRONGPASS"},
+		{"password", Check{creds: &Credentials{Password: "secret"}},
+			map[string]string{"clients": "connected_clients:3\r\n", "replication": "role:master\r\nconnected_slaves:0\r\n"}, ""},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			check := test.check
+			check.Host = listen(t, test.infos)
+
+			err := check.Check(context.Background(), logr.Discard(), &report.Report{})
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("Check() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("Check() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
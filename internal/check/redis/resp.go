@@ -0,0 +1,176 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// bulkLimit is the maximum size of a bulk string accepted from the server.
+	bulkLimit = 16 * 1024 * 1024
+	// arrayLimit is the maximum number of elements of an array accepted from the server.
+	arrayLimit = 1024 * 1024
+)
+
+// client speaks the Redis serialization protocol.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newClient(conn net.Conn) *client {
+	return &client{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// command sends a command and returns its reply. Replies are strings, integers, nil or slices of those. Error
+// replies are returned as error.
+func (c *client) command(args ...string) (interface{}, error) {
+	request := strings.Builder{}
+	request.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+
+	for _, arg := range args {
+		request.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+
+	if _, err := c.conn.Write([]byte(request.String())); err != nil {
+		return nil, fmt.Errorf("%s: send: %w", args[0], err)
+	}
+
+	reply, err := c.reply()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return reply, nil
+}
+
+// line reads a line without its terminator.
+func (c *client) line() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("receive: %w", err)
+	}
+
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// reply reads a single reply.
+func (c *client) reply() (interface{}, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	kind, rest := line[0], line[1:]
+
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, fmt.Errorf("server error: %s", rest)
+	case ':':
+		value, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("integer reply: %w", err)
+		}
+
+		return value, nil
+	case '$':
+		return c.bulk(rest)
+	case '*':
+		count, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("array reply: %w", err)
+		}
+
+		if count < 0 {
+			return nil, nil
+		}
+
+		if count > arrayLimit {
+			return nil, fmt.Errorf("array reply: %d elements exceed limit", count)
+		}
+
+		values := make([]interface{}, 0, count)
+
+		for i := 0; i < count; i++ {
+			value, err := c.reply()
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, value)
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
+
+// bulk reads the content of a bulk string with the given announced length.
+func (c *client) bulk(announced string) (interface{}, error) {
+	length, err := strconv.Atoi(announced)
+	if err != nil {
+		return nil, fmt.Errorf("bulk reply: %w", err)
+	}
+
+	if length < 0 {
+		return nil, nil
+	}
+
+	if length > bulkLimit {
+		return nil, fmt.Errorf("bulk reply: %d bytes exceed limit", length)
+	}
+
+	content := make([]byte, length+2)
+	if _, err := io.ReadFull(c.reader, content); err != nil {
+		return nil, fmt.Errorf("bulk reply: %w", err)
+	}
+
+	return string(content[:length]), nil
+}
+
+// info returns the fields of the given INFO section.
+func (c *client) info(section string) (map[string]string, error) {
+	reply, err := c.command("INFO", section)
+	if err != nil {
+		return nil, err
+	}
+
+	content, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("INFO: unexpected reply %v", reply)
+	}
+
+	fields := map[string]string{}
+
+	for _, line := range strings.Split(content, "\r\n") {
+		if name, value, found := strings.Cut(line, ":"); found && !strings.HasPrefix(line, "#") {
+			fields[name] = value
+		}
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readCommand reads a command sent by the client.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read command: %w", err)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "*"), "\r\n"))
+	if err != nil {
+		return nil, fmt.Errorf("command length: %w", err)
+	}
+
+	args := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, fmt.Errorf("read argument: %w", err)
+		}
+
+		length, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "$"), "\r\n"))
+		if err != nil {
+			return nil, fmt.Errorf("argument length: %w", err)
+		}
+
+		arg := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, fmt.Errorf("read argument: %w", err)
+		}
+
+		args = append(args, string(arg[:length]))
+	}
+
+	return args, nil
+}
+
+// serve answers the commands read from conn with the raw replies returned by handle until the client disconnects.
+func serve(t *testing.T, conn net.Conn, handle func(args []string) string) {
+	t.Helper()
+
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		if _, err := io.WriteString(conn, handle(args)); err != nil {
+			return
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    interface{}
+		problem string
+	}{
+		{"simple", "+PONG\r\n", "PONG", ""},
+		{"integer", ":-42\r\n", int64(-42), ""},
+		{"bulk", "$5\r\na\r\nbc\r\n", "a\r\nbc", ""},
+		{"empty bulk", "$0\r\n\r\n", "", ""},
+		{"nil bulk", "$-1\r\n", nil, ""},
+		{"nil array", "*-1\r\n", nil, ""},
+		{"array", "*3\r\n$10\r\nmaxclients\r\n:1\r\n*1\r\n+x\r\n",
+			[]interface{}{"maxclients", int64(1), []interface{}{"x"}}, ""},
+		{"error", "-NOAUTH Authentication required.\r\n", nil, "server error: NOAUTH Authentication required."},
+		{"bad integer", ":x\r\n", nil, "integer reply"},
+		{"bad bulk length", "$x\r\n", nil, "bulk reply"},
+		{"oversized bulk", fmt.Sprintf("$%d\r\n", bulkLimit+1), nil, "exceed limit"},
+		{"oversized array", fmt.Sprintf("*%d\r\n", arrayLimit+1), nil, "exceed limit"},
+		{"truncated bulk", "$10\r\nabc", nil, "bulk reply"},
+		{"truncated array", "*2\r\n+a\r\n", nil, "EOF"},
+		{"empty", "\r\n", nil, "empty reply"},
+		{"unknown type", "%1\r\n", nil, "unknown reply type"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			go func() {
+				defer serverConn.Close()
+
+				args, err := readCommand(bufio.NewReader(serverConn))
+				if err != nil || strings.Join(args, " ") != "CONFIG GET maxclients" {
+					t.Errorf("command = %q, %v", args, err)
+
+					return
+				}
+
+				_, _ = io.WriteString(serverConn, test.raw)
+			}()
+
+			reply, err := newClient(clientConn).command("CONFIG", "GET", "maxclients")
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Fatalf("command() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Fatalf("command() = %v, want %q", err, test.problem)
+			case !reflect.DeepEqual(reply, test.want):
+				t.Errorf("command() = %#v, want %#v", reply, test.want)
+			}
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	t.Parallel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go serve(t, serverConn, func(args []string) string {
+		content := "# Clients\r\nconnected_clients:3\r\nmaxclients:100\r\n"
+
+		return "$" + strconv.Itoa(len(content)) + "\r\n" + content + "\r\n"
+	})
+
+	fields, err := newClient(clientConn).info("clients")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]string{"connected_clients": "3", "maxclients": "100"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("info() = %v, want %v", fields, want)
+	}
+}
@@ -17,13 +17,15 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
 
-	"eqrx.net/rungroup"
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/miekg/dns"
 )
 
 // prepareTLS exchanges messages required by the SMTP protocol to enable STARTTLS.
@@ -65,36 +67,77 @@ func prepareTLS(conn io.ReadWriter) error {
 	return nil
 }
 
-func (c Check) connect(ctx context.Context, addr string) error {
-	conn, err := (&net.Dialer{}).DialContext(ctx, c.network, addr)
+// readGreeting reads the greeting the server sends after the connection is established.
+func readGreeting(conn io.Reader) error {
+	l, err := bufio.NewReader(conn).ReadString('\n')
 	if err != nil {
-		return fmt.Errorf("connect: dial: %w", err)
+		return fmt.Errorf("connect: read greeting: %w", err)
 	}
 
-	group := rungroup.New(ctx)
+	if !strings.HasPrefix(l, "220") {
+		return fmt.Errorf("connect: protocol failure: unexpected greeting: %s", strings.TrimSpace(l))
+	}
 
-	group.Go(func(ctx context.Context) error {
-		<-ctx.Done()
+	return nil
+}
 
-		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
-			return fmt.Errorf("connect: close: %w", err)
+// handshake negotiates TLS on conn according to the given mode.
+func handshake(conn net.Conn, mode tlscheck.Mode, tlsConfig *tls.Config) (*tls.Conn, error) {
+	switch mode {
+	case tlscheck.ModeSTARTTLS:
+		if err := prepareTLS(conn); err != nil {
+			return nil, err
 		}
 
-		return nil
-	})
+		tlsConn := tls.Client(conn, tlsConfig)
 
-	group.Go(func(ctx context.Context) error {
-		if err := prepareTLS(conn); err != nil {
-			return err
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("connect: tls: %w", err)
 		}
-		tlsConfig := &tls.Config{ServerName: c.Domain, MinVersion: tls.VersionTLS13}
+
+		return tlsConn, nil
+	case tlscheck.ModeTLS:
 		tlsConn := tls.Client(conn, tlsConfig)
 
 		if err := tlsConn.Handshake(); err != nil {
-			return fmt.Errorf("connect: tls: %w", err)
+			return nil, fmt.Errorf("connect: tls: %w", err)
+		}
+
+		if err := readGreeting(tlsConn); err != nil {
+			return nil, err
+		}
+
+		return tlsConn, nil
+	default:
+		panic(fmt.Sprintf("unknown mode %q", mode))
+	}
+}
+
+// connect performs a TLS handshake with the server on the given endpoint and inspects the presented certificates.
+// If DANE is enabled, the certificates are verified against the TLSA records of the server.
+func (c Check) connect(ctx context.Context, server server, endpoint Endpoint, rep *report.Report) error {
+	var records []*dns.TLSA
+
+	if c.DANE {
+		var err error
+
+		records, err = resolveTLSA(ctx, server.name, endpoint.Port)
+		if err != nil {
+			return err
+		}
+	}
+
+	addr := net.JoinHostPort(server.addr.String(), endpoint.Port)
+
+	err := netcheck.Dial(ctx, c.network, addr, func(conn net.Conn) error {
+		tlsConn, err := handshake(conn, endpoint.Mode, c.tlsConfig(server.name, records))
+		if err != nil {
+			return err
 		}
 
-		_, err = conn.Write([]byte("QUIT\n"))
+		c.Certificates.Inspect(tlsConn.ConnectionState(), rep)
+
+		_, err = tlsConn.Write([]byte("QUIT\n"))
 
 		if err != nil {
 			return fmt.Errorf("connect: sending QUIT: %w", err)
@@ -102,8 +145,7 @@ func (c Check) connect(ctx context.Context, addr string) error {
 
 		return nil
 	})
-
-	if err := group.Wait(); err != nil {
+	if err != nil {
 		return fmt.Errorf("domain %s: %w", c.Domain, err)
 	}
 
@@ -0,0 +1,179 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"github.com/miekg/dns"
+)
+
+// TLSA certificate usages as defined in RFC 6698.
+const (
+	usagePKIXTA = 0
+	usagePKIXEE = 1
+	usageDANETA = 2
+	usageDANEEE = 3
+)
+
+var errNoTLSAMatch = errors.New("dane: no TLSA record matches the presented certificates")
+
+// resolveTLSA returns the TLSA records for the given host and port. It fails if there are none or if the answer was
+// not authenticated by DNSSEC.
+func resolveTLSA(ctx context.Context, host, port string) ([]*dns.TLSA, error) {
+	question := (&dns.Msg{}).SetQuestion("_"+port+"._tcp."+dns.Fqdn(host), dns.TypeTLSA)
+	question.SetEdns0(4096, true)
+	question.AuthenticatedData = true
+
+	answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, netcheck.DNSServer)
+	if err != nil {
+		return nil, fmt.Errorf("dane: dns exchange: %w", err)
+	}
+
+	if !answer.AuthenticatedData {
+		return nil, fmt.Errorf("dane: TLSA records of %s are not authenticated by DNSSEC", host)
+	}
+
+	records := []*dns.TLSA{}
+
+	for i := range answer.Answer {
+		tlsaRecord, ok := answer.Answer[i].(*dns.TLSA)
+		if ok {
+			records = append(records, tlsaRecord)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("dane: no TLSA records for %s port %s", host, port)
+	}
+
+	return records, nil
+}
+
+// verifyPKIX verifies the peer certificates of state against the system roots and serverName.
+func verifyPKIX(state tls.ConnectionState, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("pkix: no peer certificates")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	options := x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates}
+
+	if _, err := state.PeerCertificates[0].Verify(options); err != nil {
+		return fmt.Errorf("pkix: %w", err)
+	}
+
+	return nil
+}
+
+// verifyTrustAnchor verifies that the leaf of certs chains up to anchor and carries serverName as required for
+// DANE-TA records by RFC 7672. The expiry of the anchor itself is ignored.
+func verifyTrustAnchor(certs []*x509.Certificate, anchor *x509.Certificate, serverName string) error {
+	unexpiring := *anchor
+	unexpiring.NotBefore, unexpiring.NotAfter = time.Time{}, time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(&unexpiring)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	options := x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates}
+
+	if _, err := certs[0].Verify(options); err != nil {
+		return fmt.Errorf("dane: trust anchor: %w", err)
+	}
+
+	return nil
+}
+
+// verifyDANE checks if the peer certificates of state match at least one of the given TLSA records.
+func verifyDANE(records []*dns.TLSA, state tls.ConnectionState, serverName string) error {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("dane: no peer certificates")
+	}
+
+	for _, record := range records {
+		candidates := certs[1:]
+		if record.Usage == usagePKIXEE || record.Usage == usageDANEEE {
+			candidates = certs[:1]
+		}
+
+		var matched *x509.Certificate
+
+		for _, cert := range candidates {
+			if record.Verify(cert) == nil {
+				matched = cert
+
+				break
+			}
+		}
+
+		if matched == nil {
+			continue
+		}
+
+		switch record.Usage {
+		case usagePKIXTA, usagePKIXEE:
+			if err := verifyPKIX(state, serverName); err != nil {
+				return err
+			}
+		case usageDANETA:
+			if err := verifyTrustAnchor(certs, matched, serverName); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return errNoTLSAMatch
+}
+
+// tlsConfig returns the TLS configuration for connecting to serverName. If TLSA records are given, certificates are
+// verified against them instead of the system roots. PKIX verification is still done if MTA-STS is enabled.
+func (c Check) tlsConfig(serverName string, records []*dns.TLSA) *tls.Config {
+	config := &tls.Config{ServerName: serverName, MinVersion: tlscheck.MailMinVersion}
+
+	if len(records) == 0 {
+		return config
+	}
+
+	config.InsecureSkipVerify = true //nolint:gosec // Certificates are verified against TLSA records instead.
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if c.MTASTS {
+			if err := verifyPKIX(state, serverName); err != nil {
+				return err
+			}
+		}
+
+		return verifyDANE(records, state, serverName)
+	}
+
+	return config
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// issue creates a certificate for name that is signed by parent or self-signed if parent is nil.
+func issue(t *testing.T, name string, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.DNSNames = []string{name}
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestVerifyDANETrustAnchor(t *testing.T) {
+	t.Parallel()
+
+	valid := time.Now().Add(24 * time.Hour)
+	anchor, anchorKey := issue(t, "anchor", valid, nil, nil)
+	expiredAnchor, expiredAnchorKey := issue(t, "expired anchor", time.Now().Add(-24*time.Hour), nil, nil)
+	leaf, _ := issue(t, "mx.example.com", valid, anchor, anchorKey)
+	leafOfExpired, _ := issue(t, "mx.example.com", valid, expiredAnchor, expiredAnchorKey)
+	rogue, _ := issue(t, "mx.example.com", valid, nil, nil)
+
+	record := func(cert *x509.Certificate) []*dns.TLSA {
+		tlsa := &dns.TLSA{}
+		if err := tlsa.Sign(usageDANETA, 0, 1, cert); err != nil {
+			t.Fatal(err)
+		}
+
+		return []*dns.TLSA{tlsa}
+	}
+
+	tests := []struct {
+		name       string
+		records    []*dns.TLSA
+		chain      []*x509.Certificate
+		serverName string
+		valid      bool
+	}{
+		{"chained leaf", record(anchor), []*x509.Certificate{leaf, anchor}, "mx.example.com", true},
+		{"expired anchor", record(expiredAnchor), []*x509.Certificate{leafOfExpired, expiredAnchor}, "mx.example.com", true},
+		{"foreign leaf", record(anchor), []*x509.Certificate{rogue, anchor}, "mx.example.com", false},
+		{"other name", record(anchor), []*x509.Certificate{leaf, anchor}, "mx.example.org", false},
+		{"anchor missing", record(anchor), []*x509.Certificate{leaf}, "mx.example.com", false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := verifyDANE(test.records, tls.ConnectionState{PeerCertificates: test.chain}, test.serverName)
+			if (err == nil) != test.valid {
+				t.Errorf("verifyDANE() = %v, valid %v", err, test.valid)
+			}
+		})
+	}
+}
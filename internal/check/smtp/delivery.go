@@ -0,0 +1,265 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/imap"
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/service"
+)
+
+const (
+	// probeHeader is the mail header that carries the token identifying a probe message.
+	probeHeader = "X-Healthcheck-Probe"
+	// defaultDeadline is how long a probe message may take to arrive if no deadline is configured.
+	defaultDeadline = time.Minute
+	// pollInterval defines how often the mailbox is searched for the probe message.
+	pollInterval = time.Second
+)
+
+// Login is a username and password pair.
+type Login struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Credentials contains the logins used by the delivery probe. If IMAP is not set the SMTP login is used for both.
+type Credentials struct {
+	SMTP Login `yaml:"smtp"`
+	IMAP Login `yaml:"imap"`
+}
+
+// Delivery sends a tagged message via an authenticated submission and waits for it to show up in an IMAP mailbox.
+type Delivery struct {
+	CredsName  string        `yaml:"credsName"`
+	Submission string        `yaml:"submission"`
+	Mode       tlscheck.Mode `yaml:"mode"`
+	IMAP       string        `yaml:"imap"`
+	Mailbox    string        `yaml:"mailbox"`
+	From       string        `yaml:"from"`
+	To         string        `yaml:"to"`
+	Deadline   time.Duration `yaml:"deadline"`
+	creds      Credentials   `yaml:"-"`
+}
+
+// Setup loads the credentials and fills in defaults.
+func (d *Delivery) Setup() error {
+	if d.Submission == "" || d.IMAP == "" || d.From == "" {
+		return fmt.Errorf("delivery: submission, imap and from must be set")
+	}
+
+	switch d.Mode {
+	case tlscheck.ModeSTARTTLS, tlscheck.ModeTLS:
+	case "":
+		d.Mode = tlscheck.ModeSTARTTLS
+	default:
+		return fmt.Errorf("delivery: unknown mode %q", d.Mode)
+	}
+
+	if d.Mailbox == "" {
+		d.Mailbox = "INBOX"
+	}
+
+	if d.To == "" {
+		d.To = d.From
+	}
+
+	if d.Deadline == 0 {
+		d.Deadline = defaultDeadline
+	}
+
+	if err := service.UnmarshalYAMLCreds(d.CredsName, &d.creds); err != nil {
+		return fmt.Errorf("delivery: credentials: %w", err)
+	}
+
+	if d.creds.IMAP.Username == "" {
+		d.creds.IMAP = d.creds.SMTP
+	}
+
+	return nil
+}
+
+// probe sends a message with a unique token and waits until it can be found via IMAP. The time it took between
+// submission and arrival is reported as delivery latency. The certificates of both servers are inspected.
+func (d Delivery) probe(ctx context.Context, network string, inspection tlscheck.Inspection, rep *report.Report) error {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		panic(fmt.Sprintf("read random: %v", err))
+	}
+
+	token := hex.EncodeToString(tokenBytes)
+
+	send := func(conn net.Conn) error { return d.send(conn, token, inspection, rep.Sub("submission")) }
+
+	if err := netcheck.Dial(ctx, network, d.Submission, send); err != nil {
+		return fmt.Errorf("delivery: send: %w", err)
+	}
+
+	sent := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, d.Deadline)
+	defer cancel()
+
+	await := func(conn net.Conn) error { return d.await(ctx, conn, token, inspection, rep.Sub("imap")) }
+
+	if err := netcheck.Dial(ctx, network, d.IMAP, await); err != nil {
+		return fmt.Errorf("delivery: await: %w", err)
+	}
+
+	rep.Metric("delivery_latency", time.Since(sent).Seconds(), "s")
+
+	return nil
+}
+
+// send submits the probe message over conn.
+func (d Delivery) send(conn net.Conn, token string, inspection tlscheck.Inspection, rep *report.Report) error {
+	host, _, err := net.SplitHostPort(d.Submission)
+	if err != nil {
+		return fmt.Errorf("submission address: %w", err)
+	}
+
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tlscheck.MailMinVersion}
+
+	if d.Mode == tlscheck.ModeTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+
+	if err := client.Hello("healthcheck"); err != nil {
+		return fmt.Errorf("EHLO: %w", err)
+	}
+
+	if d.Mode == tlscheck.ModeSTARTTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+
+	if state, ok := client.TLSConnectionState(); ok {
+		inspection.Inspect(state, rep)
+	}
+
+	if err := client.Auth(smtp.PlainAuth("", d.creds.SMTP.Username, d.creds.SMTP.Password, host)); err != nil {
+		return fmt.Errorf("AUTH: %w", err)
+	}
+
+	if err := client.Mail(d.From); err != nil {
+		return fmt.Errorf("MAIL FROM: %w", err)
+	}
+
+	if err := client.Rcpt(d.To); err != nil {
+		return fmt.Errorf("RCPT TO: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+
+	if _, err := writer.Write([]byte(d.message(token))); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("end DATA: %w", err)
+	}
+
+	if err := client.Quit(); err != nil {
+		return fmt.Errorf("QUIT: %w", err)
+	}
+
+	return nil
+}
+
+// message formats the probe message carrying token.
+func (d Delivery) message(token string) string {
+	lines := []string{
+		"From: " + d.From,
+		"To: " + d.To,
+		"Subject: healthcheck delivery probe " + token,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + token + "@healthcheck>",
+		probeHeader + ": " + token,
+		"",
+		"This message was sent by healthcheck to verify mail delivery and will be deleted automatically.",
+		"",
+	}
+
+	return strings.Join(lines, "\r\n")
+}
+
+// await logs into the mailbox over conn and searches for the probe message until it arrives or ctx is done.
+// The message is deleted once found.
+func (d Delivery) await(
+	ctx context.Context, conn net.Conn, token string, inspection tlscheck.Inspection, rep *report.Report,
+) error {
+	host, _, err := net.SplitHostPort(d.IMAP)
+	if err != nil {
+		return fmt.Errorf("imap address: %w", err)
+	}
+
+	client, err := imap.NewClient(tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tlscheck.MailMinVersion}))
+	if err != nil {
+		return err
+	}
+
+	if state, ok := client.TLSConnectionState(); ok {
+		inspection.Inspect(state, rep)
+	}
+
+	if err := client.Login(d.creds.IMAP.Username, d.creds.IMAP.Password); err != nil {
+		return err
+	}
+
+	if err := client.Select(d.Mailbox); err != nil {
+		return err
+	}
+
+	for {
+		uids, err := client.Search(probeHeader, token)
+		if err != nil {
+			return err
+		}
+
+		if len(uids) != 0 {
+			if err := client.Delete(uids); err != nil {
+				return err
+			}
+
+			return client.Logout()
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("message did not arrive: %w", ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// recommendedKeyBits is the DKIM RSA key size below which a warning is reported.
+const recommendedKeyBits = 2048
+
+// parseRSAKey parses a DKIM RSA public key, which may be encoded as SubjectPublicKeyInfo or PKCS #1.
+func parseRSAKey(der []byte) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("expected RSA key, got %T", key)
+	}
+
+	return rsaKey, nil
+}
+
+// checkDKIM validates the DKIM key record of the given selector. RSA keys smaller than the configured minimum fail
+// the check, keys smaller than the recommended size are reported as warning.
+func (m MailAuth) checkDKIM(ctx context.Context, selector string, rep *report.Report) error {
+	records, err := resolveTXT(ctx, selector+"._domainkey."+m.Domain)
+	if err != nil {
+		return fmt.Errorf("resolve TXT: %w", err)
+	}
+
+	if len(records) != 1 {
+		return fmt.Errorf("expected exactly one record, found %d", len(records))
+	}
+
+	tags := parseTags(records[0])
+
+	if version, ok := tags["v"]; ok && version != "DKIM1" {
+		return fmt.Errorf("unsupported version %q", version)
+	}
+
+	encodedKey := strings.Join(strings.Fields(tags["p"]), "")
+	if encodedKey == "" {
+		return fmt.Errorf("key is revoked")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return fmt.Errorf("decode key: %w", err)
+	}
+
+	switch keyType := tags["k"]; keyType {
+	case "rsa", "":
+		key, err := parseRSAKey(der)
+		if err != nil {
+			return err
+		}
+
+		bits := key.N.BitLen()
+
+		switch {
+		case bits < m.MinKeyBits:
+			return fmt.Errorf("RSA key has %d bits, expected at least %d", bits, m.MinKeyBits)
+		case bits < recommendedKeyBits:
+			rep.Warn("dkim selector %s: RSA key has only %d bits", selector, bits)
+		}
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return fmt.Errorf("ed25519 key has invalid size %d", len(der))
+		}
+	default:
+		return fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	return nil
+}
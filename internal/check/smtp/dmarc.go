@@ -0,0 +1,103 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// dmarcPolicyStrength orders DMARC policies by how strictly they treat failing mail. False is returned for unknown
+// policies.
+func dmarcPolicyStrength(policy string) (int, bool) {
+	switch policy {
+	case "none":
+		return 0, true
+	case "quarantine":
+		return 1, true
+	case "reject":
+		return 2, true
+	default:
+		return 0, false
+	}
+}
+
+// checkDMARC validates the DMARC record of the domain and checks that its policy is at least as strict as the
+// configured one. Policies that do not act on all mail are reported as warning.
+func (m MailAuth) checkDMARC(ctx context.Context, rep *report.Report) error {
+	records, err := resolveTXT(ctx, "_dmarc."+m.Domain)
+	if err != nil {
+		return fmt.Errorf("resolve TXT: %w", err)
+	}
+
+	dmarcRecords := []string{}
+
+	for _, record := range records {
+		if strings.HasPrefix(record, "v=DMARC1") {
+			dmarcRecords = append(dmarcRecords, record)
+		}
+	}
+
+	if len(dmarcRecords) != 1 {
+		return fmt.Errorf("expected exactly one record, found %d", len(dmarcRecords))
+	}
+
+	tags := parseTags(dmarcRecords[0])
+
+	policy := tags["p"]
+
+	strength, ok := dmarcPolicyStrength(policy)
+	if !ok {
+		return fmt.Errorf("invalid policy %q", policy)
+	}
+
+	if subdomainPolicy, ok := tags["sp"]; ok {
+		if _, ok := dmarcPolicyStrength(subdomainPolicy); !ok {
+			return fmt.Errorf("invalid subdomain policy %q", subdomainPolicy)
+		}
+	}
+
+	if percentage, ok := tags["pct"]; ok {
+		value, err := strconv.Atoi(percentage)
+		if err != nil || value < 0 || value > 100 {
+			return fmt.Errorf("invalid percentage %q", percentage)
+		}
+
+		if value < 100 {
+			rep.Warn("dmarc: policy only applies to %d%% of mail", value)
+		}
+	}
+
+	for _, tag := range []string{"rua", "ruf"} {
+		for _, uri := range strings.Split(tags[tag], ",") {
+			if uri = strings.TrimSpace(uri); uri != "" && !strings.Contains(uri, ":") {
+				return fmt.Errorf("invalid %s URI %q", tag, uri)
+			}
+		}
+	}
+
+	if required, _ := dmarcPolicyStrength(m.DMARCPolicy); m.DMARCPolicy != "" && strength < required {
+		return fmt.Errorf("policy %s is weaker than %s", policy, m.DMARCPolicy)
+	}
+
+	if policy == "none" {
+		rep.Warn("dmarc: policy is none")
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// defaultMinKeyBits is the minimum size of DKIM RSA keys if none is configured.
+const defaultMinKeyBits = 1024
+
+// MailAuth validates the SPF, DKIM and DMARC records of a domain.
+type MailAuth struct {
+	Domain        string   `yaml:"domain"`
+	DKIMSelectors []string `yaml:"dkimSelectors"`
+	MinKeyBits    int      `yaml:"minKeyBits"`
+	DMARCPolicy   string   `yaml:"dmarcPolicy"`
+}
+
+// Setup validates the configuration and fills in defaults.
+func (m *MailAuth) Setup() error {
+	if m.Domain == "" {
+		return fmt.Errorf("no domain given")
+	}
+
+	if m.MinKeyBits == 0 {
+		m.MinKeyBits = defaultMinKeyBits
+	}
+
+	if _, ok := dmarcPolicyStrength(m.DMARCPolicy); m.DMARCPolicy != "" && !ok {
+		return fmt.Errorf("unknown DMARC policy %q", m.DMARCPolicy)
+	}
+
+	return nil
+}
+
+// Check validates the SPF record, all configured DKIM selectors and the DMARC record of the domain.
+func (m MailAuth) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if err := m.checkSPF(ctx, rep); err != nil {
+		return fmt.Errorf("mailauth check: spf: %w", err)
+	}
+
+	for _, selector := range m.DKIMSelectors {
+		if err := m.checkDKIM(ctx, selector, rep); err != nil {
+			return fmt.Errorf("mailauth check: dkim selector %s: %w", selector, err)
+		}
+	}
+
+	if err := m.checkDMARC(ctx, rep); err != nil {
+		return fmt.Errorf("mailauth check: dmarc: %w", err)
+	}
+
+	return nil
+}
+
+// parseTags parses a tag list as used by DKIM and DMARC records.
+func parseTags(record string) map[string]string {
+	tags := map[string]string{}
+
+	for _, field := range strings.Split(record, ";") {
+		key, value, ok := strings.Cut(field, "=")
+		if ok {
+			tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,226 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// mtaSTSPolicyLimit is the maximum size of an MTA-STS policy file that is read.
+	mtaSTSPolicyLimit = 64 * 1024
+	// mtaSTSModeNone is the MTA-STS policy mode that indicates no policy is in effect.
+	mtaSTSModeNone = "none"
+)
+
+// mtaSTSPolicy is a parsed MTA-STS policy as defined in RFC 8461.
+type mtaSTSPolicy struct {
+	mode string
+	mx   []string
+}
+
+// parseMTASTSPolicy parses an MTA-STS policy file.
+func parseMTASTSPolicy(reader io.Reader) (mtaSTSPolicy, error) {
+	var policy mtaSTSPolicy
+
+	version := ""
+	maxAge := ""
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "version":
+			version = value
+		case "mode":
+			policy.mode = value
+		case "mx":
+			policy.mx = append(policy.mx, strings.ToLower(value))
+		case "max_age":
+			maxAge = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return policy, fmt.Errorf("read: %w", err)
+	}
+
+	switch {
+	case version != "STSv1":
+		return policy, fmt.Errorf("unsupported version %q", version)
+	case policy.mode != "enforce" && policy.mode != "testing" && policy.mode != mtaSTSModeNone:
+		return policy, fmt.Errorf("invalid mode %q", policy.mode)
+	case maxAge == "":
+		return policy, fmt.Errorf("max_age missing")
+	case policy.mode != mtaSTSModeNone && len(policy.mx) == 0:
+		return policy, fmt.Errorf("no mx patterns")
+	}
+
+	return policy, nil
+}
+
+// matches checks if the policy allows the given MX host.
+func (p mtaSTSPolicy) matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range p.mx {
+		if pattern == host {
+			return true
+		}
+
+		if suffix := strings.TrimPrefix(pattern, "*"); suffix != pattern {
+			if label := strings.TrimSuffix(host, suffix); label != host && label != "" && !strings.Contains(label, ".") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkMTASTS verifies the MTA-STS TXT record of the domain, loads its policy and checks that all given MX hosts
+// are allowed by it.
+func (c Check) checkMTASTS(ctx context.Context, mxHosts []string) error {
+	records, err := resolveTXT(ctx, "_mta-sts."+c.Domain)
+	if err != nil {
+		return fmt.Errorf("mta-sts: resolve TXT: %w", err)
+	}
+
+	stsRecords := []string{}
+
+	for _, record := range records {
+		if strings.HasPrefix(record, "v=STSv1") {
+			stsRecords = append(stsRecords, record)
+		}
+	}
+
+	if len(stsRecords) != 1 {
+		return fmt.Errorf("mta-sts: expected exactly one TXT record, found %d", len(stsRecords))
+	}
+
+	if !strings.Contains(stsRecords[0], "id=") {
+		return fmt.Errorf("mta-sts: TXT record has no id")
+	}
+
+	policy, err := c.fetchMTASTSPolicy(ctx)
+	if err != nil {
+		return fmt.Errorf("mta-sts: policy: %w", err)
+	}
+
+	if policy.mode == mtaSTSModeNone {
+		return nil
+	}
+
+	for _, host := range mxHosts {
+		if !policy.matches(host) {
+			return fmt.Errorf("mta-sts: MX host %s not allowed by policy", host)
+		}
+	}
+
+	return nil
+}
+
+// fetchMTASTSPolicy loads the MTA-STS policy of the domain via HTTPS. Redirects are not followed as mandated by
+// RFC 8461.
+func (c Check) fetchMTASTSPolicy(ctx context.Context) (mtaSTSPolicy, error) {
+	url := "https://mta-sts." + c.Domain + "/.well-known/mta-sts.txt"
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		panic(fmt.Sprintf("create http request: %v", err))
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			IdleConnTimeout: 1 * time.Second,
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, c.network, addr)
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return mtaSTSPolicy{}, fmt.Errorf("execute http request: %w", err)
+	}
+
+	policy, parseErr := parseMTASTSPolicy(io.LimitReader(response.Body, mtaSTSPolicyLimit))
+
+	closeErr := response.Body.Close()
+
+	switch {
+	case response.StatusCode != http.StatusOK:
+		return mtaSTSPolicy{}, fmt.Errorf("unexpected http response status: %v", response.StatusCode)
+	case !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain"):
+		return mtaSTSPolicy{}, fmt.Errorf("unexpected content type: %s", response.Header.Get("Content-Type"))
+	case parseErr != nil:
+		return mtaSTSPolicy{}, fmt.Errorf("parse: %w", parseErr)
+	case closeErr != nil:
+		return mtaSTSPolicy{}, fmt.Errorf("close body: %w", closeErr)
+	default:
+		return policy, nil
+	}
+}
+
+// checkTLSRPT verifies that the domain has exactly one valid TLS-RPT record as defined in RFC 8460.
+func (c Check) checkTLSRPT(ctx context.Context) error {
+	records, err := resolveTXT(ctx, "_smtp._tls."+c.Domain)
+	if err != nil {
+		return fmt.Errorf("tls-rpt: resolve TXT: %w", err)
+	}
+
+	rptRecords := []string{}
+
+	for _, record := range records {
+		if strings.HasPrefix(record, "v=TLSRPTv1") {
+			rptRecords = append(rptRecords, record)
+		}
+	}
+
+	if len(rptRecords) != 1 {
+		return fmt.Errorf("tls-rpt: expected exactly one TXT record, found %d", len(rptRecords))
+	}
+
+	for _, field := range strings.Split(rptRecords[0], ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		if key != "rua" {
+			continue
+		}
+
+		for _, uri := range strings.Split(value, ",") {
+			uri = strings.TrimSpace(uri)
+			if !strings.HasPrefix(uri, "mailto:") && !strings.HasPrefix(uri, "https://") {
+				return fmt.Errorf("tls-rpt: invalid rua %q", uri)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("tls-rpt: record has no rua")
+}
@@ -16,55 +16,49 @@ package smtp
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"strings"
 
+	"eqrx.net/healthcheck/internal/check/netcheck"
 	"github.com/miekg/dns"
 )
 
-const (
-	// dnsServer defines the port and address from which to query DNS records.
-	// Set to cloudflare DNS to avoid as much record caching as possible.
-	dnsServer = "[2606:4700:4700::1111]:53"
-	// smtpPort defines the port that is assumed for SMTP servers pointed to from within MX records.
-	smtpPort = "25"
-)
+// smtpPort defines the port that is checked for SMTP servers pointed to from within MX records if no endpoints
+// are configured.
+const smtpPort = "25"
+
+// server is the address of an SMTP server together with the name it was resolved from.
+type server struct {
+	name string
+	addr netip.Addr
+}
 
-func (c Check) resolveServer(ctx context.Context) ([]string, error) {
+func (c Check) resolveServer(ctx context.Context) ([]server, error) {
 	serverNames, err := c.resolveMX(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("resolve MX: %w", err)
 	}
 
-	serverAddrs := []string{}
+	servers := []server{}
 
 	for _, serverName := range serverNames {
-		question := (&dns.Msg{}).SetQuestion(serverName, c.targetRRType)
-
-		answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, dnsServer)
+		addrs, err := netcheck.Resolve(ctx, serverName, c.targetRRType)
 		if err != nil {
-			return nil, fmt.Errorf("dns exchange: %w", err)
+			return nil, fmt.Errorf("resolve %s: %w", serverName, err)
 		}
 
-		for i := range answer.Answer {
-			switch record := answer.Answer[i].(type) {
-			case *dns.A:
-				if c.targetRRType == dns.TypeA {
-					serverAddrs = append(serverAddrs, record.A.String())
-				}
-			case *dns.AAAA:
-				if c.targetRRType == dns.TypeAAAA {
-					serverAddrs = append(serverAddrs, record.AAAA.String())
-				}
-			}
+		for _, addr := range addrs {
+			servers = append(servers, server{name: strings.TrimSuffix(serverName, "."), addr: addr})
 		}
 	}
 
-	return serverAddrs, nil
+	return servers, nil
 }
 
 func (c Check) resolveMX(ctx context.Context) ([]string, error) {
 	question := (&dns.Msg{}).SetQuestion(dns.Fqdn(c.Domain), dns.TypeMX)
 
-	answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, dnsServer)
+	answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, netcheck.DNSServer)
 	if err != nil {
 		return nil, fmt.Errorf("dns exchange: %w", err)
 	}
@@ -80,3 +74,24 @@ func (c Check) resolveMX(ctx context.Context) ([]string, error) {
 
 	return serverNames, nil
 }
+
+// resolveTXT returns all TXT records of name with their strings joined.
+func resolveTXT(ctx context.Context, name string) ([]string, error) {
+	question := (&dns.Msg{}).SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+
+	answer, _, err := (&dns.Client{}).ExchangeContext(ctx, question, netcheck.DNSServer)
+	if err != nil {
+		return nil, fmt.Errorf("dns exchange: %w", err)
+	}
+
+	records := []string{}
+
+	for i := range answer.Answer {
+		txtRecord, ok := answer.Answer[i].(*dns.TXT)
+		if ok {
+			records = append(records, strings.Join(txtRecord.Txt, ""))
+		}
+	}
+
+	return records, nil
+}
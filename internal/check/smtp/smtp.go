@@ -18,62 +18,165 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
 	"eqrx.net/rungroup"
 	"github.com/go-logr/logr"
-	"github.com/miekg/dns"
 )
 
-// Check resolves an SMTP server and tess it TLS function.
+// Endpoint is a port on the SMTP servers together with the way TLS is negotiated on it. Implicit TLS is used for
+// submission on port 465.
+type Endpoint struct {
+	Port string        `yaml:"port"`
+	Mode tlscheck.Mode `yaml:"mode"`
+}
+
+// Check resolves an SMTP server and tess it TLS function. Optionally the MTA-STS policy, TLS-RPT record and TLSA
+// records of the domain and its MX hosts are verified. Presented certificates are inspected as configured.
+// AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
 type Check struct {
-	IPV4         bool   `yaml:"ipv4"`
-	Domain       string `yaml:"domain"`
-	targetRRType uint16 `yaml:"-"`
-	network      string `yaml:"-"`
+	IPV4               bool                `yaml:"ipv4"`
+	AddressFamilies    string              `yaml:"addressFamilies"`
+	RequireAllFamilies bool                `yaml:"requireAllFamilies"`
+	Domain             string              `yaml:"domain"`
+	Endpoints          []Endpoint          `yaml:"endpoints"`
+	Delivery           *Delivery           `yaml:"delivery"`
+	MTASTS             bool                `yaml:"mtaSTS"`
+	TLSRPT             bool                `yaml:"tlsRPT"`
+	DANE               bool                `yaml:"dane"`
+	Certificates       tlscheck.Inspection `yaml:"certificates"`
+	families           []netcheck.Family   `yaml:"-"`
+	targetRRType       uint16              `yaml:"-"`
+	network            string              `yaml:"-"`
 }
 
-// Setup prepares often used values.
-func (c *Check) Setup() {
-	c.targetRRType = dns.TypeAAAA
+// Setup prepares often used values. If no endpoints are given, STARTTLS on port 25 is checked.
+// The delivery probe is set up if configured.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
 
-	if c.IPV4 {
-		c.targetRRType = dns.TypeA
+	if len(c.Endpoints) == 0 {
+		c.Endpoints = []Endpoint{{Port: smtpPort, Mode: tlscheck.ModeSTARTTLS}}
 	}
 
-	c.network = "tcp6"
-	if c.IPV4 {
-		c.network = "tcp4"
+	for i := range c.Endpoints {
+		if c.Endpoints[i].Port == "" {
+			return fmt.Errorf("endpoint %d: no port given", i)
+		}
+
+		switch c.Endpoints[i].Mode {
+		case tlscheck.ModeSTARTTLS, tlscheck.ModeTLS:
+		case "":
+			c.Endpoints[i].Mode = tlscheck.ModeSTARTTLS
+		default:
+			return fmt.Errorf("endpoint %s: unknown mode %q", c.Endpoints[i].Port, c.Endpoints[i].Mode)
+		}
 	}
-}
 
-// Check resolves the SMTP of the domain and connects to it via TLS.
-func (c Check) Check(ctx context.Context, _ logr.Logger) error {
-	addrs, err := c.resolveServer(ctx)
-	if err != nil {
-		return fmt.Errorf("smtp check: resolve server: %w", err)
+	if c.Delivery != nil {
+		return c.Delivery.Setup()
 	}
 
-	if len(addrs) == 0 {
-		return fmt.Errorf("smtp check: no servers defined for addr")
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// checkPolicies verifies the MTA-STS policy and TLS-RPT record of the domain if enabled.
+func (c Check) checkPolicies(ctx context.Context) error {
+	if c.MTASTS {
+		mxNames, err := c.resolveMX(ctx)
+		if err != nil {
+			return fmt.Errorf("resolve MX: %w", err)
+		}
+
+		mxHosts := []string{}
+		for _, name := range mxNames {
+			mxHosts = append(mxHosts, strings.TrimSuffix(name, "."))
+		}
+
+		if err := c.checkMTASTS(ctx, mxHosts); err != nil {
+			return err
+		}
 	}
 
-	group := rungroup.New(ctx)
+	if c.TLSRPT {
+		if err := c.checkTLSRPT(ctx); err != nil {
+			return err
+		}
+	}
 
-	for i := range addrs {
-		hostPort := net.JoinHostPort(addrs[i], smtpPort)
+	return nil
+}
 
-		group.Go(func(ctx context.Context) error {
-			if err := c.connect(ctx, hostPort); err != nil {
-				return fmt.Errorf("connect %s: %w", hostPort, err)
-			}
+// Check verifies the policies of the domain, resolves its SMTP servers for each address family and connects to all
+// their endpoints via TLS. If the delivery probe is configured, it is run once afterwards.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if err := c.checkPolicies(ctx); err != nil {
+		return fmt.Errorf("smtp check: %w", err)
+	}
 
-			return nil
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
 		})
+	if err != nil {
+		return fmt.Errorf("smtp check: %w", err)
 	}
 
-	if err := group.Wait(); err != nil {
-		return fmt.Errorf("smtp check: %w", err)
+	if c.Delivery != nil {
+		if err := c.Delivery.probe(ctx, c.network, c.Certificates, rep); err != nil {
+			return fmt.Errorf("smtp check: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// checkServers resolves the SMTP servers of the domain and connects to all their endpoints via TLS.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	servers, err := c.resolveServer(ctx)
+	if err != nil {
+		return fmt.Errorf("resolve server: %w", err)
+	}
+
+	if len(servers) == 0 {
+		return fmt.Errorf("servers: %w", netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range servers {
+		for j := range c.Endpoints {
+			server := servers[i]
+			endpoint := c.Endpoints[j]
+			hostPort := net.JoinHostPort(server.addr.String(), endpoint.Port)
+
+			group.Go(func(ctx context.Context) error {
+				if err := c.connect(ctx, server, endpoint, rep.Sub(hostPort)); err != nil {
+					return fmt.Errorf("connect %s (%s, %s): %w", hostPort, server.name, endpoint.Mode, err)
+				}
+
+				return nil
+			}, rungroup.NeverCancel)
+		}
+	}
+
+	return group.Wait()
+}
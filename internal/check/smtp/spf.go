@@ -0,0 +1,169 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// spfLookupLimit is the maximum number of DNS lookups evaluating an SPF record may cause as defined in RFC 7208.
+const spfLookupLimit = 10
+
+// lookupSPF returns the only SPF record of domain.
+func lookupSPF(ctx context.Context, domain string) (string, error) {
+	records, err := resolveTXT(ctx, domain)
+	if err != nil {
+		return "", fmt.Errorf("resolve TXT: %w", err)
+	}
+
+	spfRecords := []string{}
+
+	for _, record := range records {
+		if record == "v=spf1" || strings.HasPrefix(record, "v=spf1 ") {
+			spfRecords = append(spfRecords, record)
+		}
+	}
+
+	if len(spfRecords) != 1 {
+		return "", fmt.Errorf("expected exactly one record for %s, found %d", domain, len(spfRecords))
+	}
+
+	return spfRecords[0], nil
+}
+
+// parseSPFTerm splits an SPF term into its qualifier, name and value.
+func parseSPFTerm(term string) (string, string, string) {
+	if name, value, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+		return "", strings.ToLower(name), value
+	}
+
+	qualifier := "+"
+	if strings.ContainsAny(term[:1], "+-~?") {
+		qualifier, term = term[:1], term[1:]
+	}
+
+	index := strings.IndexAny(term, ":/")
+	if index < 0 {
+		return qualifier, strings.ToLower(term), ""
+	}
+
+	return qualifier, strings.ToLower(term[:index]), strings.TrimPrefix(term[index:], ":")
+}
+
+// spfTerm validates a term of the SPF record of domain. It returns if evaluating the term causes a DNS lookup and
+// the domain whose record is included, if any. Unknown modifiers are ignored as required by RFC 7208.
+func spfTerm(domain, term string) (bool, string, error) {
+	qualifier, name, value := parseSPFTerm(term)
+
+	switch name {
+	case "all":
+		return false, "", nil
+	case "ip4", "ip6":
+		if _, err := netip.ParsePrefix(value); err != nil {
+			if _, err := netip.ParseAddr(value); err != nil {
+				return false, "", fmt.Errorf("%s: invalid address %q", domain, value)
+			}
+		}
+
+		return false, "", nil
+	case "a", "mx", "ptr", "exists":
+		return true, "", nil
+	case "include", "redirect":
+		if strings.Contains(value, "%") {
+			return true, "", nil
+		}
+
+		return true, value, nil
+	}
+
+	if qualifier == "" {
+		return false, "", nil
+	}
+
+	return false, "", fmt.Errorf("%s: unknown mechanism %q", domain, term)
+}
+
+// walkSPF validates the SPF record of domain and all records it includes and returns it. The DNS lookups evaluating
+// them causes are counted in lookups. Walking stops as soon as the limit is exceeded.
+func walkSPF(ctx context.Context, domain string, lookups *int) (string, error) {
+	record, err := lookupSPF(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+
+	for _, term := range strings.Fields(record)[1:] {
+		lookup, nested, err := spfTerm(domain, term)
+		if err != nil {
+			return "", err
+		}
+
+		if !lookup {
+			continue
+		}
+
+		if *lookups++; *lookups > spfLookupLimit {
+			return "", fmt.Errorf("more than %d DNS lookups", spfLookupLimit)
+		}
+
+		if nested == "" {
+			continue
+		}
+
+		if _, err := walkSPF(ctx, nested, lookups); err != nil {
+			return "", fmt.Errorf("%s %s: %w", term, nested, err)
+		}
+	}
+
+	return record, nil
+}
+
+// checkSPF validates the SPF record of the domain and checks that it stays within the DNS lookup limit.
+// Permissive or missing "all" mechanisms are reported as warnings.
+func (m MailAuth) checkSPF(ctx context.Context, rep *report.Report) error {
+	lookups := 0
+
+	record, err := walkSPF(ctx, m.Domain, &lookups)
+
+	rep.Metric("spf_lookups", float64(lookups), "")
+
+	if err != nil {
+		return err
+	}
+
+	terminated := false
+
+	for _, term := range strings.Fields(record)[1:] {
+		qualifier, name, _ := parseSPFTerm(term)
+
+		switch {
+		case name == "all" && qualifier == "+":
+			rep.Warn("spf: record allows all senders")
+
+			terminated = true
+		case name == "all", name == "redirect":
+			terminated = true
+		}
+	}
+
+	if !terminated {
+		rep.Warn("spf: record has neither all mechanism nor redirect")
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import "testing"
+
+func TestParseSPFTerm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		term, qualifier, name, value string
+	}{
+		{"all", "+", "all", ""},
+		{"-all", "-", "all", ""},
+		{"~ALL", "~", "all", ""},
+		{"include:_spf.example.com", "+", "include", "_spf.example.com"},
+		{"?mx:mail.example.com/24", "?", "mx", "mail.example.com/24"},
+		{"a/24", "+", "a", "/24"},
+		{"ip6:2001:db8::/32", "+", "ip6", "2001:db8::/32"},
+		{"redirect=_spf.example.com", "", "redirect", "_spf.example.com"},
+		{"exists:%{i}.bl.example.com", "+", "exists", "%{i}.bl.example.com"},
+		{"ra=postmaster", "", "ra", "postmaster"},
+	}
+
+	for _, test := range tests {
+		qualifier, name, value := parseSPFTerm(test.term)
+		if qualifier != test.qualifier || name != test.name || value != test.value {
+			t.Errorf("parseSPFTerm(%q) = %q, %q, %q; want %q, %q, %q",
+				test.term, qualifier, name, value, test.qualifier, test.name, test.value)
+		}
+	}
+}
+
+func TestSPFTerm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		term   string
+		lookup bool
+		nested string
+		valid  bool
+	}{
+		{"-all", false, "", true},
+		{"ip4:192.0.2.0/24", false, "", true},
+		{"ip4:192.0.2.1", false, "", true},
+		{"ip6:2001:db8::1", false, "", true},
+		{"ip4:example.com", false, "", false},
+		{"a", true, "", true},
+		{"mx", true, "", true},
+		{"ptr", true, "", true},
+		{"exists:%{i}.bl.example.com", true, "", true},
+		{"include:_spf.example.com", true, "_spf.example.com", true},
+		{"redirect=_spf.example.com", true, "_spf.example.com", true},
+		{"include:%{d}.example.com", true, "", true},
+		{"exp=explain.example.com", false, "", true},
+		{"ra=postmaster", false, "", true},
+		{"x-vendor=whatever", false, "", true},
+		{"foo", false, "", false},
+		{"~bar:example.com", false, "", false},
+	}
+
+	for _, test := range tests {
+		lookup, nested, err := spfTerm("example.com", test.term)
+		if lookup != test.lookup || nested != test.nested || (err == nil) != test.valid {
+			t.Errorf("spfTerm(%q) = %v, %q, %v; want %v, %q, valid %v",
+				test.term, lookup, nested, err, test.lookup, test.nested, test.valid)
+		}
+	}
+}
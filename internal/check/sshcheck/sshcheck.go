@@ -0,0 +1,233 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package sshcheck contains a health check for SSH servers.
+package sshcheck
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultPort is the port SSH servers listen on if nothing else is configured.
+	defaultPort = "22"
+	// bannerLines is the maximum number of lines a server may send before its version line.
+	bannerLines = 16
+)
+
+// errKeyExchangeDone aborts the handshake once the host key is known, there is no need to log in.
+var errKeyExchangeDone = errors.New("key exchange done")
+
+// Check resolves a host and connects to all its addresses. The version line sent by the server is optionally
+// matched against Banner. A key exchange is performed and the host key needs to match one of the SHA256
+// fingerprints in HostKeys as printed by ssh-keygen -l. HostKeyAlgorithms restricts the host key types offered
+// to the server, for example to verify a specific one of its keys.
+// AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool              `yaml:"ipv4"`
+	AddressFamilies    string            `yaml:"addressFamilies"`
+	RequireAllFamilies bool              `yaml:"requireAllFamilies"`
+	Host               string            `yaml:"host"`
+	Port               string            `yaml:"port"`
+	Banner             string            `yaml:"banner"`
+	HostKeys           []string          `yaml:"hostKeys"`
+	HostKeyAlgorithms  []string          `yaml:"hostKeyAlgorithms"`
+	banner             *regexp.Regexp    `yaml:"-"`
+	families           []netcheck.Family `yaml:"-"`
+	targetRRType       uint16            `yaml:"-"`
+	network            string            `yaml:"-"`
+}
+
+// Setup prepares often used values. The port defaults to 22.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Host == "" {
+		return fmt.Errorf("no host given")
+	}
+
+	if len(c.HostKeys) == 0 {
+		return fmt.Errorf("no host keys given")
+	}
+
+	for _, fingerprint := range c.HostKeys {
+		if !strings.HasPrefix(fingerprint, "SHA256:") {
+			return fmt.Errorf("host key %s: not a SHA256 fingerprint", fingerprint)
+		}
+	}
+
+	if c.Port == "" {
+		c.Port = defaultPort
+	}
+
+	if c.Banner != "" {
+		banner, err := regexp.Compile(c.Banner)
+		if err != nil {
+			return fmt.Errorf("banner: %w", err)
+		}
+
+		c.banner = banner
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// Check resolves the host for each address family and verifies all its addresses.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	err := netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep)
+		})
+	if err != nil {
+		return fmt.Errorf("ssh check: %w", err)
+	}
+
+	return nil
+}
+
+// checkServers resolves the host and connects to all its addresses.
+func (c Check) checkServers(ctx context.Context, rep *report.Report) error {
+	addrs, err := netcheck.Resolve(ctx, c.Host, c.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", c.Host, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", c.Host, netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		hostPort := net.JoinHostPort(addrs[i].String(), c.Port)
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.connect(ctx, hostPort, rep.Sub(hostPort)); err != nil {
+				return fmt.Errorf("connect %s: %w", hostPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+// replayConn is a connection whose reads are served from reader, which replays what was already consumed.
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c replayConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// readBanner reads the lines sent by the server up to its version line. A connection is returned that replays them
+// for the key exchange.
+func readBanner(conn net.Conn) (string, net.Conn, error) {
+	reader := bufio.NewReader(conn)
+	consumed := strings.Builder{}
+
+	for i := 0; i < bannerLines; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", nil, fmt.Errorf("banner: %w", err)
+		}
+
+		consumed.WriteString(line)
+
+		if strings.HasPrefix(line, "SSH-") {
+			replayed := io.MultiReader(strings.NewReader(consumed.String()), reader)
+
+			return strings.TrimRight(line, "\r\n"), replayConn{Conn: conn, reader: replayed}, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("banner: no version line within %d lines", bannerLines)
+}
+
+// connect dials addr, reads the version line of the server and performs a key exchange to obtain its host key.
+func (c Check) connect(ctx context.Context, addr string, rep *report.Report) error {
+	start := time.Now()
+
+	return netcheck.Dial(ctx, c.network, addr, func(conn net.Conn) error {
+		version, conn, err := readBanner(conn)
+		if err != nil {
+			return err
+		}
+
+		rep.Note("version %s", version)
+
+		if c.banner != nil && !c.banner.MatchString(version) {
+			return fmt.Errorf("version %q does not match %q", version, c.Banner)
+		}
+
+		var hostKey ssh.PublicKey
+
+		config := &ssh.ClientConfig{
+			User:              "healthcheck",
+			HostKeyAlgorithms: c.HostKeyAlgorithms,
+			HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+				hostKey = key
+
+				return errKeyExchangeDone
+			},
+		}
+
+		if _, _, _, err := ssh.NewClientConn(conn, addr, config); hostKey == nil {
+			return fmt.Errorf("key exchange: %w", err)
+		}
+
+		rep.Metric("handshake_time", time.Since(start).Seconds(), "s")
+
+		fingerprint := ssh.FingerprintSHA256(hostKey)
+
+		for _, expected := range c.HostKeys {
+			if fingerprint == expected {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("unexpected %s host key %s", hostKey.Type(), fingerprint)
+	})
+}
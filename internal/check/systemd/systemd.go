@@ -0,0 +1,217 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package systemd contains a health check for units of the systemd system manager.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// destination is the bus name of the systemd manager.
+	destination = "org.freedesktop.systemd1"
+	// managerPath is the object path of the systemd manager.
+	managerPath = "/org/freedesktop/systemd1"
+	// stateActive is the ActiveState of units that run or ran successfully.
+	stateActive = "active"
+)
+
+// Timer is a timer unit that needs to have triggered within MaxAge.
+type Timer struct {
+	Name   string        `yaml:"name"`
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// Check queries the systemd system manager over D-Bus. All listed units need to be active and listed timers need
+// to have triggered recently. The check fails if any unit that is not ignored has failed.
+type Check struct {
+	Units        []string `yaml:"units"`
+	Timers       []Timer  `yaml:"timers"`
+	IgnoreFailed []string `yaml:"ignoreFailed"`
+}
+
+// failedUnit is a single entry returned by ListUnitsFiltered.
+type failedUnit struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Following   string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// Setup validates the timers.
+func (c *Check) Setup() error {
+	for _, timer := range c.Timers {
+		if !strings.HasSuffix(timer.Name, ".timer") {
+			return fmt.Errorf("timer %s: not a timer unit", timer.Name)
+		}
+
+		if timer.MaxAge <= 0 {
+			return fmt.Errorf("timer %s: no max age given", timer.Name)
+		}
+	}
+
+	return nil
+}
+
+// property returns a property of the unit with the given name.
+func property(ctx context.Context, conn *dbus.Conn, unit, iface, name string) (interface{}, error) {
+	var path dbus.ObjectPath
+
+	manager := conn.Object(destination, managerPath)
+
+	if err := manager.CallWithContext(ctx, destination+".Manager.LoadUnit", 0, unit).Store(&path); err != nil {
+		return nil, fmt.Errorf("load unit: %w", err)
+	}
+
+	var value dbus.Variant
+
+	object := conn.Object(destination, path)
+
+	err := object.CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, iface, name).Store(&value)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", name, err)
+	}
+
+	return value.Value(), nil
+}
+
+// checkUnit fails if the unit is not active.
+func checkUnit(ctx context.Context, conn *dbus.Conn, unit string) error {
+	activeState, err := property(ctx, conn, unit, destination+".Unit", "ActiveState")
+	if err != nil {
+		return err
+	}
+
+	if activeState == stateActive {
+		return nil
+	}
+
+	subState, err := property(ctx, conn, unit, destination+".Unit", "SubState")
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%v (%v)", activeState, subState)
+}
+
+// checkTimer records how long ago the timer triggered and fails if that exceeds its maximum age.
+func checkTimer(ctx context.Context, conn *dbus.Conn, timer Timer, rep *report.Report) error {
+	value, err := property(ctx, conn, timer.Name, destination+".Timer", "LastTriggerUSec")
+	if err != nil {
+		return err
+	}
+
+	lastTrigger, ok := value.(uint64)
+	if !ok {
+		return fmt.Errorf("LastTriggerUSec has type %T", value)
+	}
+
+	if lastTrigger == 0 {
+		return fmt.Errorf("never triggered")
+	}
+
+	age := time.Since(time.UnixMicro(int64(lastTrigger)))
+
+	rep.Metric("last_trigger_age", age.Hours(), "h")
+
+	if age > timer.MaxAge {
+		return fmt.Errorf("last triggered %s ago", age.Round(time.Second))
+	}
+
+	return nil
+}
+
+// failedUnits returns the names of all failed units that are not ignored.
+func (c Check) failedUnits(ctx context.Context, conn *dbus.Conn) ([]string, error) {
+	var units []failedUnit
+
+	manager := conn.Object(destination, managerPath)
+
+	err := manager.CallWithContext(ctx, destination+".Manager.ListUnitsFiltered", 0, []string{"failed"}).Store(&units)
+	if err != nil {
+		return nil, fmt.Errorf("list failed units: %w", err)
+	}
+
+	names := []string{}
+
+outer:
+	for _, unit := range units {
+		for _, ignored := range c.IgnoreFailed {
+			if unit.Name == ignored {
+				continue outer
+			}
+		}
+
+		names = append(names, unit.Name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Check connects to the system bus and verifies units, timers and failed units.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	conn, err := dbus.ConnectSystemBus(dbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("systemd: connect to system bus: %w", err)
+	}
+
+	defer conn.Close()
+
+	problems := []string{}
+
+	for _, unit := range c.Units {
+		if err := checkUnit(ctx, conn, unit); err != nil {
+			problems = append(problems, fmt.Sprintf("unit %s: %v", unit, err))
+		}
+	}
+
+	for _, timer := range c.Timers {
+		if err := checkTimer(ctx, conn, timer, rep.Sub(timer.Name)); err != nil {
+			problems = append(problems, fmt.Sprintf("timer %s: %v", timer.Name, err))
+		}
+	}
+
+	failed, err := c.failedUnits(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("systemd: %w", err)
+	}
+
+	rep.Metric("failed_units", float64(len(failed)), "")
+
+	if len(failed) != 0 {
+		problems = append(problems, "failed units: "+strings.Join(failed, ", "))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("systemd: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
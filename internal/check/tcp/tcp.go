@@ -0,0 +1,196 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package tcp contains health checks for generic TCP and TLS services.
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// bannerLimit is the maximum number of bytes read while waiting for the expected banner.
+	bannerLimit = 64 * 1024
+	// quoteLimit is the maximum number of received bytes quoted in errors.
+	quoteLimit = 256
+)
+
+// wrapper is applied to a connection after it is established, for example to negotiate TLS.
+type wrapper func(net.Conn, *report.Report) (net.Conn, error)
+
+// Check resolves a host and connects to all its addresses. Optionally a payload is sent and the response is
+// expected to match a regular expression. AddressFamilies selects v4, v6 or both and takes precedence over IPV4.
+type Check struct {
+	IPV4               bool              `yaml:"ipv4"`
+	AddressFamilies    string            `yaml:"addressFamilies"`
+	RequireAllFamilies bool              `yaml:"requireAllFamilies"`
+	Host               string            `yaml:"host"`
+	Port               string            `yaml:"port"`
+	Send               string            `yaml:"send"`
+	Expect             string            `yaml:"expect"`
+	expect             *regexp.Regexp    `yaml:"-"`
+	families           []netcheck.Family `yaml:"-"`
+	targetRRType       uint16            `yaml:"-"`
+	network            string            `yaml:"-"`
+}
+
+// Setup prepares often used values.
+func (c *Check) Setup() error {
+	families, err := netcheck.Families(c.AddressFamilies, c.IPV4)
+	if err != nil {
+		return err
+	}
+
+	c.families = families
+	*c = c.forFamily(families[0])
+
+	if c.Host == "" || c.Port == "" {
+		return fmt.Errorf("host and port must be set")
+	}
+
+	if c.Expect != "" {
+		expect, err := regexp.Compile(c.Expect)
+		if err != nil {
+			return fmt.Errorf("expect: %w", err)
+		}
+
+		c.expect = expect
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of c that probes the given address family.
+func (c Check) forFamily(family netcheck.Family) Check {
+	c.IPV4 = family.IPV4()
+	c.targetRRType = family.RRType()
+	c.network = family.Network("tcp")
+
+	return c
+}
+
+// Check resolves the host for each address family and connects to all its addresses.
+func (c Check) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if err := c.run(ctx, rep, nil); err != nil {
+		return fmt.Errorf("tcp check: %w", err)
+	}
+
+	return nil
+}
+
+// run resolves the host for each address family and calls connect for each address. If wrap is given, it is applied
+// to every connection before the payload is exchanged.
+func (c Check) run(ctx context.Context, rep *report.Report, wrap wrapper) error {
+	return netcheck.ForFamilies(ctx, c.families, c.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return c.forFamily(family).checkServers(ctx, rep, wrap)
+		})
+}
+
+// checkServers resolves the host and calls connect for each address.
+func (c Check) checkServers(ctx context.Context, rep *report.Report, wrap wrapper) error {
+	addrs, err := netcheck.Resolve(ctx, c.Host, c.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", c.Host, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", c.Host, netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		hostPort := net.JoinHostPort(addrs[i].String(), c.Port)
+
+		group.Go(func(ctx context.Context) error {
+			if err := c.connect(ctx, hostPort, rep.Sub(hostPort), wrap); err != nil {
+				return fmt.Errorf("connect %s: %w", hostPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+// connect dials addr, applies wrap if given and exchanges the payload. The time it took to establish the connection
+// is reported as metric.
+func (c Check) connect(ctx context.Context, addr string, rep *report.Report, wrap wrapper) error {
+	start := time.Now()
+
+	return netcheck.Dial(ctx, c.network, addr, func(conn net.Conn) error {
+		if wrap != nil {
+			var err error
+
+			if conn, err = wrap(conn, rep); err != nil {
+				return err
+			}
+		}
+
+		rep.Metric("connect_time", time.Since(start).Seconds(), "s")
+
+		return c.exchange(conn)
+	})
+}
+
+// exchange sends the payload and reads from conn until the expected banner shows up.
+func (c Check) exchange(conn net.Conn) error {
+	if c.Send != "" {
+		if _, err := conn.Write([]byte(c.Send)); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	}
+
+	if c.expect == nil {
+		return nil
+	}
+
+	received := []byte{}
+	buffer := make([]byte, 4096)
+
+	for len(received) < bannerLimit {
+		n, err := conn.Read(buffer)
+		received = append(received, buffer[:n]...)
+
+		if c.expect.Match(received) {
+			return nil
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return fmt.Errorf("read: %w", err)
+		}
+	}
+
+	if len(received) > quoteLimit {
+		return fmt.Errorf("response does not match %q: %q... (%d bytes)", c.Expect, received[:quoteLimit], len(received))
+	}
+
+	return fmt.Errorf("response does not match %q: %q", c.Expect, received)
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package tcp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+// pipe returns a client connection whose server side is handled by serve. The test waits for serve to return.
+func pipe(t *testing.T, serve func(net.Conn)) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		defer server.Close()
+
+		serve(server)
+	}()
+
+	return client
+}
+
+func TestExchange(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		send     string
+		expect   string
+		response string
+		problem  string
+	}{
+		{"connect only", "", "", "", ""},
+		{"banner", "", `^\+OK`, "+OK ready\r\n", ""},
+		{"reply", "PING\r\n", `^\+PONG\r\n$`, "+PONG\r\n", ""},
+		{"mismatch", "PING\r\n", `^\+PONG`, "-ERR auth\r\n", `response does not match "^\\+PONG": "-ERR auth\r\n"`},
+		{"long mismatch", "", "^SSH-", strings.Repeat("x", 1000), `"` + strings.Repeat("x", 256) + `"... (1000 bytes)`},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := pipe(t, func(conn net.Conn) {
+				received := make([]byte, len(test.send))
+				if _, err := io.ReadFull(conn, received); err != nil {
+					return
+				}
+
+				if string(received) != test.send {
+					t.Errorf("received %q, want %q", received, test.send)
+				}
+
+				_, _ = io.WriteString(conn, test.response)
+			})
+
+			check := Check{Send: test.send, Expect: test.expect}
+			if test.expect != "" {
+				check.expect = regexp.MustCompile(test.expect)
+			}
+
+			err := check.exchange(conn)
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("exchange() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("exchange() = %v, want %q", err, test.problem)
+			}
+		})
+	}
+}
+
+// certificate returns a self-signed certificate for localhost and a pool trusting it.
+func certificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{raw}, PrivateKey: key}, roots
+}
+
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+
+	cert, roots := certificate(t)
+
+	tests := []struct {
+		name       string
+		serverName string
+		alpn       []string
+		serverALPN []string
+		problem    string
+	}{
+		{"plain", "localhost", nil, nil, ""},
+		{"alpn", "localhost", []string{"h2", "http/1.1"}, []string{"http/1.1"}, ""},
+		{"alpn ignored", "localhost", []string{"h2"}, nil, "tls: no protocol out of [h2] negotiated"},
+		{"alpn mismatch", "localhost", []string{"h2"}, []string{"imap"}, "tls:"},
+		{"wrong name", "example.org", nil, nil, "tls:"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := pipe(t, func(conn net.Conn) {
+				config := &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: test.serverALPN}
+				server := tls.Server(conn, config)
+
+				if err := server.Handshake(); err != nil {
+					return
+				}
+
+				_, _ = io.Copy(io.Discard, server)
+			})
+
+			check := TLSCheck{ServerName: test.serverName, ALPN: test.alpn, roots: roots}
+
+			tlsConn, err := check.handshake(conn, &report.Report{})
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Errorf("handshake() = %v", err)
+			case test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)):
+				t.Errorf("handshake() = %v, want %q", err, test.problem)
+			}
+
+			if tlsConn != nil {
+				tlsConn.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+
+	"eqrx.net/healthcheck/internal/check/tlscheck"
+	"eqrx.net/healthcheck/internal/report"
+	"github.com/go-logr/logr"
+)
+
+// TLSCheck is a Check that completes a TLS handshake on every connection before the payload is exchanged.
+type TLSCheck struct {
+	TCP          Check               `yaml:",inline"`
+	ServerName   string              `yaml:"serverName"`
+	ALPN         []string            `yaml:"alpn"`
+	Certificates tlscheck.Inspection `yaml:"certificates"`
+	roots        *x509.CertPool      `yaml:"-"`
+}
+
+// Setup prepares often used values. The server name defaults to the host.
+func (c *TLSCheck) Setup() error {
+	if err := c.TCP.Setup(); err != nil {
+		return err
+	}
+
+	if c.ServerName == "" {
+		c.ServerName = c.TCP.Host
+	}
+
+	return nil
+}
+
+// handshake completes a TLS handshake on conn, verifies the negotiated protocol and inspects the certificates.
+// Certificates are verified against the system roots unless roots is set.
+func (c TLSCheck) handshake(conn net.Conn, rep *report.Report) (net.Conn, error) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: c.ServerName,
+		NextProtos: c.ALPN,
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    c.roots,
+	})
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	state := tlsConn.ConnectionState()
+
+	if len(c.ALPN) != 0 && state.NegotiatedProtocol == "" {
+		return nil, fmt.Errorf("tls: no protocol out of %v negotiated", c.ALPN)
+	}
+
+	c.Certificates.Inspect(state, rep)
+
+	return tlsConn, nil
+}
+
+// Check resolves the host, connects to all its addresses and completes a TLS handshake.
+func (c TLSCheck) Check(ctx context.Context, _ logr.Logger, rep *report.Report) error {
+	if err := c.TCP.run(ctx, rep, c.handshake); err != nil {
+		return fmt.Errorf("tls check: %w", err)
+	}
+
+	return nil
+}
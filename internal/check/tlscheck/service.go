@@ -0,0 +1,201 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package tlscheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/check/netcheck"
+	"eqrx.net/healthcheck/internal/report"
+	"eqrx.net/rungroup"
+	"eqrx.net/service"
+)
+
+// Mode defines how TLS is negotiated with a server.
+type Mode string
+
+const (
+	// ModeSTARTTLS connects in plain text and upgrades the connection via a command of the protocol.
+	ModeSTARTTLS Mode = "starttls"
+	// ModeTLS connects with implicit TLS.
+	ModeTLS Mode = "tls"
+)
+
+// Credentials contains the login used to authenticate with a server.
+type Credentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Service is a server speaking a protocol that is offered with implicit TLS and STARTTLS. Checks of such protocols
+// embed it to resolve the host, connect to all its addresses and negotiate TLS. Only the dialogue is left to them.
+// Presented certificates are inspected as configured. AddressFamilies selects v4, v6 or both and takes precedence
+// over IPV4.
+type Service struct {
+	IPV4               bool              `yaml:"ipv4"`
+	AddressFamilies    string            `yaml:"addressFamilies"`
+	RequireAllFamilies bool              `yaml:"requireAllFamilies"`
+	Host               string            `yaml:"host"`
+	Port               string            `yaml:"port"`
+	Mode               Mode              `yaml:"mode"`
+	CredsName          string            `yaml:"credsName"`
+	Certificates       Inspection        `yaml:"certificates"`
+	creds              *Credentials      `yaml:"-"`
+	families           []netcheck.Family `yaml:"-"`
+	targetRRType       uint16            `yaml:"-"`
+	network            string            `yaml:"-"`
+}
+
+// Setup prepares often used values and loads the credentials if configured. The mode defaults to implicit TLS and
+// the port to the given one of the mode.
+func (s *Service) Setup(tlsPort, startTLSPort string) error {
+	families, err := netcheck.Families(s.AddressFamilies, s.IPV4)
+	if err != nil {
+		return err
+	}
+
+	s.families = families
+	*s = s.forFamily(families[0])
+
+	switch s.Mode {
+	case ModeTLS, "":
+		s.Mode = ModeTLS
+
+		if s.Port == "" {
+			s.Port = tlsPort
+		}
+	case ModeSTARTTLS:
+		if s.Port == "" {
+			s.Port = startTLSPort
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", s.Mode)
+	}
+
+	if s.CredsName != "" {
+		s.creds = &Credentials{}
+
+		if err := service.UnmarshalYAMLCreds(s.CredsName, s.creds); err != nil {
+			return fmt.Errorf("credentials: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// forFamily returns a copy of s that probes the given address family.
+func (s Service) forFamily(family netcheck.Family) Service {
+	s.IPV4 = family.IPV4()
+	s.targetRRType = family.RRType()
+	s.network = family.Network("tcp")
+
+	return s
+}
+
+// Creds returns the credentials or nil if none are configured.
+func (s Service) Creds() *Credentials {
+	return s.creds
+}
+
+func (s Service) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: s.Host, MinVersion: MailMinVersion}
+}
+
+// Run resolves the host for each address family and calls fn with a connection to each of its addresses
+// concurrently. In implicit TLS mode the TLS handshake is completed before.
+func (s Service) Run(ctx context.Context, rep *report.Report, fn func(net.Conn, *report.Report) error) error {
+	return netcheck.ForFamilies(ctx, s.families, s.RequireAllFamilies, rep,
+		func(ctx context.Context, family netcheck.Family, rep *report.Report) error {
+			return s.forFamily(family).run(ctx, rep, fn)
+		})
+}
+
+// run resolves the host and calls fn with a connection to each of its addresses concurrently.
+func (s Service) run(ctx context.Context, rep *report.Report, fn func(net.Conn, *report.Report) error) error {
+	addrs, err := netcheck.Resolve(ctx, s.Host, s.targetRRType)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", s.Host, err)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s: %w", s.Host, netcheck.ErrNoAddresses)
+	}
+
+	group := rungroup.New(ctx)
+
+	for i := range addrs {
+		hostPort := net.JoinHostPort(addrs[i].String(), s.Port)
+
+		group.Go(func(ctx context.Context) error {
+			err := netcheck.Dial(ctx, s.network, hostPort, func(conn net.Conn) error {
+				if s.Mode == ModeTLS {
+					tlsConn, err := s.StartTLS(conn)
+					if err != nil {
+						return err
+					}
+
+					conn = tlsConn
+				}
+
+				return fn(conn, rep.Sub(hostPort))
+			})
+			if err != nil {
+				return fmt.Errorf("connect %s: %w", hostPort, err)
+			}
+
+			return nil
+		}, rungroup.NeverCancel)
+	}
+
+	return group.Wait()
+}
+
+// StartTLS completes a TLS handshake on conn. It is also used by protocols after they agreed on STARTTLS.
+func (s Service) StartTLS(conn net.Conn) (*tls.Conn, error) {
+	tlsConn := tls.Client(conn, s.tlsConfig())
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	return tlsConn, nil
+}
+
+// MissingCapabilities returns all wanted capabilities that are not announced in have. A capability matches if it
+// is equal to the first word of an announced one, ignoring case.
+func MissingCapabilities(have, wanted []string) []string {
+	missing := []string{}
+
+	for _, want := range wanted {
+		found := false
+
+		for _, capability := range have {
+			if fields := strings.Fields(capability); len(fields) != 0 && strings.EqualFold(fields[0], want) {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, want)
+		}
+	}
+
+	return missing
+}
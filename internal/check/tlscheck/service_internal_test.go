@@ -0,0 +1,41 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+package tlscheck
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingCapabilities(t *testing.T) {
+	t.Parallel()
+
+	have := []string{"IMAP4rev1", "STARTTLS", "SASL PLAIN LOGIN", "IDLE"}
+
+	tests := []struct {
+		wanted  []string
+		missing []string
+	}{
+		{nil, []string{}},
+		{[]string{"starttls", "IDLE"}, []string{}},
+		{[]string{"SASL"}, []string{}},
+		{[]string{"PLAIN", "UIDPLUS", "IDLE"}, []string{"PLAIN", "UIDPLUS"}},
+	}
+
+	for _, test := range tests {
+		if missing := MissingCapabilities(have, test.wanted); !reflect.DeepEqual(missing, test.missing) {
+			t.Errorf("MissingCapabilities(%q) = %q, want %q", test.wanted, missing, test.missing)
+		}
+	}
+}
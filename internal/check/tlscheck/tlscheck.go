@@ -0,0 +1,88 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package tlscheck inspects certificates presented during TLS handshakes.
+package tlscheck
+
+import (
+	"crypto/tls"
+	"strings"
+	"time"
+
+	"eqrx.net/healthcheck/internal/report"
+)
+
+const (
+	// defaultExpiryWarning is how long before its expiry a certificate is warned about if nothing else is configured.
+	defaultExpiryWarning = 14 * 24 * time.Hour
+	// MailMinVersion is the lowest TLS version mail servers need to offer for SMTP, submission, IMAP and POP3.
+	MailMinVersion = tls.VersionTLS13
+)
+
+// Inspection defines what to look for in the certificates presented by a server.
+type Inspection struct {
+	ExpiryWarning time.Duration `yaml:"expiryWarning"`
+	RequireOCSP   bool          `yaml:"requireOCSP"`
+	Issuers       []string      `yaml:"issuers"`
+}
+
+// issued checks if any certificate in state was issued by one of the expected issuers, identified by common name
+// or organization.
+func (i Inspection) issued(state tls.ConnectionState) bool {
+	for _, cert := range state.PeerCertificates {
+		names := append([]string{cert.Issuer.CommonName}, cert.Issuer.Organization...)
+
+		for _, name := range names {
+			for _, issuer := range i.Issuers {
+				if strings.EqualFold(name, issuer) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Inspect checks the certificates of the given TLS connection state. The days until the leaf certificate expires are
+// reported as metric. Warnings are recorded if it expires within the warning window, no OCSP response was stapled
+// while required or none of the expected issuers is part of the chain.
+func (i Inspection) Inspect(state tls.ConnectionState, rep *report.Report) {
+	if len(state.PeerCertificates) == 0 {
+		rep.Warn("tls: no peer certificates")
+
+		return
+	}
+
+	window := i.ExpiryWarning
+	if window == 0 {
+		window = defaultExpiryWarning
+	}
+
+	leaf := state.PeerCertificates[0]
+	remaining := time.Until(leaf.NotAfter)
+
+	rep.Metric("cert_expiry_days", remaining.Hours()/24, "d")
+
+	if remaining < window {
+		rep.Warn("tls: certificate %s expires at %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if i.RequireOCSP && len(state.OCSPResponse) == 0 {
+		rep.Warn("tls: no OCSP response stapled")
+	}
+
+	if len(i.Issuers) != 0 && !i.issued(state) {
+		rep.Warn("tls: chain not issued by any of %s", strings.Join(i.Issuers, ", "))
+	}
+}
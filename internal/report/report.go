@@ -0,0 +1,135 @@
+// Copyright (C) 2022 Alexander Sowitzki
+//
+// This program is free software: you can redistribute it and/or modify it under the terms of the
+// GNU Affero General Public License as published by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but WITHOUT ANY WARRANTY; without even the implied
+// warranty of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Affero General Public License along with this program.
+// If not, see <https://www.gnu.org/licenses/>.
+
+// Package report collects details about a check run that go beyond its result.
+package report
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Metric is a value measured while running a check.
+type Metric struct {
+	Name  string
+	Value float64
+	Unit  string
+}
+
+// String formats the metric in a human readable way.
+func (m Metric) String() string {
+	return fmt.Sprintf("%s=%g%s", m.Name, m.Value, m.Unit)
+}
+
+// Report collects warnings, notes and metrics of a single check run. Warnings indicate a degradation that does not yet
+// fail the check, notes carry plain information about the checked service. It may be used concurrently.
+type Report struct {
+	mutex    sync.Mutex
+	warnings []string
+	notes    []string
+	metrics  []Metric
+	parent   *Report
+	name     string
+}
+
+// Sub returns a report for a part of the check, like a single address. Everything recorded in it is passed on to r,
+// prefixed with name, so sub reports themselves always appear empty.
+func (r *Report) Sub(name string) *Report {
+	return &Report{parent: r, name: name}
+}
+
+// Warn records a warning.
+func (r *Report) Warn(format string, args ...interface{}) {
+	if r.parent != nil {
+		r.parent.Warn("%s: %s", r.name, fmt.Sprintf(format, args...))
+
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+// Warnings returns all warnings recorded so far.
+func (r *Report) Warnings() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.warnings...)
+}
+
+// Note records an information that neither is a problem nor a measured value.
+func (r *Report) Note(format string, args ...interface{}) {
+	if r.parent != nil {
+		r.parent.Note("%s: %s", r.name, fmt.Sprintf(format, args...))
+
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.notes = append(r.notes, fmt.Sprintf(format, args...))
+}
+
+// Notes returns all notes recorded so far.
+func (r *Report) Notes() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.notes...)
+}
+
+// Metric records a measured value under the given name.
+func (r *Report) Metric(name string, value float64, unit string) {
+	if r.parent != nil {
+		r.parent.Metric(r.name+": "+name, value, unit)
+
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics = append(r.metrics, Metric{Name: name, Value: value, Unit: unit})
+}
+
+// Metrics returns all metrics recorded so far.
+func (r *Report) Metrics() []Metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Metric{}, r.metrics...)
+}
+
+// String formats all recorded details, one per line.
+func (r *Report) String() string {
+	lines := []string{}
+
+	for _, warning := range r.Warnings() {
+		lines = append(lines, "warning: "+warning)
+	}
+
+	for _, note := range r.Notes() {
+		lines = append(lines, "note: "+note)
+	}
+
+	for _, metric := range r.Metrics() {
+		lines = append(lines, metric.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
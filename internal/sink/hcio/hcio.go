@@ -18,6 +18,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"eqrx.net/healthcheck/internal/report"
 )
 
 // Sink sends pings to healthchecks.io.
@@ -26,15 +29,15 @@ type Sink struct {
 }
 
 // Sink performs a HTTP request to the healthchecks.io servers to ping the check identified by the given UUID.
-// It returns nil if the ping was successful.
-func (s Sink) Sink(ctx context.Context, checkErr error) error {
+// Warnings and metrics of the report are sent along as ping body. It returns nil if the ping was successful.
+func (s Sink) Sink(ctx context.Context, rep *report.Report, checkErr error) error {
 	if isOK := checkErr == nil; !isOK {
 		return nil
 	}
 
 	url := "https://hc-ping.com/" + s.UUID
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(rep.String()))
 	if err != nil {
 		panic(fmt.Sprintf("create request: %v", err))
 	}
@@ -17,7 +17,9 @@ package matrix
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"eqrx.net/healthcheck/internal/report"
 	"eqrx.net/matrix"
 	"eqrx.net/matrix/room"
 	"eqrx.net/service"
@@ -64,9 +66,14 @@ func (s *Sink) Setup(ctx context.Context, name string) error {
 	return nil
 }
 
-// Sink spams messages in a matrix room and talks about received errors.
-func (s *Sink) Sink(ctx context.Context, checkErr error) error {
+// Sink spams messages in a matrix room and talks about received errors and warnings. Metrics are left out since
+// they would defeat deduplication.
+func (s *Sink) Sink(ctx context.Context, rep *report.Report, checkErr error) error {
 	message := s.name + ": OK"
+	if warnings := rep.Warnings(); len(warnings) != 0 {
+		message = s.name + ": OK with warnings: " + strings.Join(warnings, "; ")
+	}
+
 	if checkErr != nil {
 		message = s.name + ": " + checkErr.Error()
 	}
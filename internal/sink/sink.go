@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 
+	"eqrx.net/healthcheck/internal/report"
 	"eqrx.net/healthcheck/internal/sink/hcio"
 	matrixsink "eqrx.net/healthcheck/internal/sink/matrix"
 )
@@ -26,9 +27,9 @@ var errConcrete = errors.New("more or less than one concrete types set for sink"
 
 // Sink contains concrete sink implementations.
 type Sink struct {
-	Matrix *matrixsink.Sink                   `yaml:"matrix"`
-	HCIO   *hcio.Sink                         `yaml:"hcio"`
-	Sink   func(context.Context, error) error `yaml:"-"`
+	Matrix *matrixsink.Sink                                   `yaml:"matrix"`
+	HCIO   *hcio.Sink                                         `yaml:"hcio"`
+	Sink   func(context.Context, *report.Report, error) error `yaml:"-"`
 }
 
 // Setup the given sink for sending.